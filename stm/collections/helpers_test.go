@@ -0,0 +1,6 @@
+package collections
+
+import "github.com/sidmishraw/stm-reworked/stm"
+
+// lockingModes are all the locking modes, the tests run in each of them.
+var lockingModes = []stm.LockingMode{stm.ScanLocking, stm.EncounterTimeLocking, stm.CommitTimeLocking}
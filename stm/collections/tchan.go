@@ -0,0 +1,201 @@
+/**
+* tchan.go
+* @description Transactional channel with broadcast semantics, and its adapter to Go channels.
+ */
+
+package collections
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+// ErrWriteOnly is reported when reading from a broadcast `TChan`, it can only be read through its duplicates.
+var ErrWriteOnly = errors.New("collections: read from a write only channel")
+
+// TChan is a transactional channel, inspired by Haskell's TChan. The items are kept in a linked list
+// whose links are `TVar`s, with the write end shared by all the duplicates of the channel and a read end,
+// a cursor into the list, of each duplicate of its own. An item written is delivered only when the
+// writing transaction commits, an item read is put back when the reading transaction rolls back.
+// Each duplicate reads every item written after it was made, so the readers of different duplicates
+// never conflict with each other.
+// The items are copied as is, so they should be value types or never be modified once written.
+// The links, and the read ends of the duplicates, are transient MemoryCells, garbage collected once every
+// duplicate has read past them.
+// `stm`: The STM the MemoryCells of the links are made on
+// `write`: The write end, the empty link the next item is written into
+// `read`: The read end, the link the next item is read from, nil for the broadcast channels
+type TChan[T any] struct {
+	stm   *stm.STM
+	write *stm.TVar[*stm.TVar[*tcons[T]]]
+	read  *stm.TVar[*stm.TVar[*tcons[T]]]
+}
+
+// tcons is a link of a TChan holding an item, the empty links are nil.
+type tcons[T any] struct {
+	value T
+	next  *stm.TVar[*tcons[T]]
+}
+
+// NewTChan makes a new empty `TChan` on the STM.
+// usage:
+// events := collections.NewTChan[Event](MySTM)
+func NewTChan[T any](s *stm.STM) *TChan[T] {
+	ch, end := newTChan[T](s)
+	ch.read = stm.NewTVar(s, end, stm.CloneValue)
+	return ch
+}
+
+// NewBroadcastTChan makes a new empty write only `TChan` on the STM. Reading from it fails with
+// `ErrWriteOnly`, the items written are read through its duplicates, made using `Dup`. The items
+// written while it has no duplicates are dropped.
+// usage:
+// prices := collections.NewBroadcastTChan[Price](MySTM)
+func NewBroadcastTChan[T any](s *stm.STM) *TChan[T] {
+	ch, _ := newTChan[T](s)
+	return ch
+}
+
+// newTChan makes a new empty TChan without a read end, along with the empty link its write end is at.
+func newTChan[T any](s *stm.STM) (*TChan[T], *stm.TVar[*tcons[T]]) {
+	ch := new(TChan[T])
+	ch.stm = s
+	end := stm.NewTransientTVar[*tcons[T]](s, nil, stm.CloneValue)
+	ch.write = stm.NewTVar(s, end, stm.CloneValue)
+	return ch, end
+}
+
+// Dup a transactional duplication of the channel. The duplicate shares the write end of the channel, it
+// reads every item written to the channel, or any of its duplicates, from now on.
+// usage:
+// subscriber, err := stm.ExecT(stm.DoneT(MySTM.NewT(), func(t *stm.Transaction) *collections.TChan[Price] {
+// 	return prices.Dup(t)
+// }))
+func (ch *TChan[T]) Dup(t *stm.Transaction) *TChan[T] {
+	dup := new(TChan[T])
+	dup.stm = ch.stm
+	dup.write = ch.write
+	dup.read = stm.NewTransientTVar(ch.stm, stm.ReadTVar(t, ch.write), stm.CloneValue)
+	return dup
+}
+
+// Write a transactional write of the item to the channel, delivered when the transaction commits.
+// Returns `stm.ErrConflict` when the transaction couldn't take the ownership of the write end, the
+// action should return it so that the transaction retries.
+func (ch *TChan[T]) Write(t *stm.Transaction, item T) error {
+	next := stm.NewTransientTVar[*tcons[T]](ch.stm, nil, stm.CloneValue)
+	end := stm.ReadTVar(t, ch.write)
+	if !stm.WriteTVar(t, end, &tcons[T]{value: item, next: next}) {
+		return stm.ErrConflict
+	}
+	if !stm.WriteTVar(t, ch.write, next) {
+		return stm.ErrConflict
+	}
+	return nil
+}
+
+// Read a transactional read of the next item from the channel. When there is none, the transaction
+// retries, blocking until an item is written. Returns `stm.ErrRetry` in that case, or `stm.ErrConflict`
+// when the transaction couldn't take the ownership of the read end, the action should return it.
+// usage:
+// DoErr(func(t *stm.Transaction) error {
+// 	event, err := events.Read(t)
+// 	if err != nil {
+// 		return err
+// 	}
+// 	...
+// })
+func (ch *TChan[T]) Read(t *stm.Transaction) (item T, err error) {
+	item, ok, err := ch.TryRead(t)
+	if err == nil && !ok {
+		err = t.Retry() // empty, wait for a writer
+	}
+	return item, err
+}
+
+// TryRead a transactional read of the next item from the channel, just like `Read`, but it returns
+// false right away when there is none.
+func (ch *TChan[T]) TryRead(t *stm.Transaction) (item T, ok bool, err error) {
+	if ch.read == nil {
+		return item, false, ErrWriteOnly
+	}
+	cons := stm.ReadTVar(t, stm.ReadTVar(t, ch.read))
+	if cons == nil {
+		return item, false, nil
+	}
+	if !stm.WriteTVar(t, ch.read, cons.next) {
+		return item, false, stm.ErrConflict
+	}
+	return cons.value, true, nil
+}
+
+// Peek a transactional read of the next item from the channel, without removing it. Returns false when
+// there is none, or the channel is a broadcast channel.
+func (ch *TChan[T]) Peek(t *stm.Transaction) (item T, ok bool) {
+	if ch.read == nil {
+		return item, false
+	}
+	if cons := stm.ReadTVar(t, stm.ReadTVar(t, ch.read)); cons != nil {
+		return cons.value, true
+	}
+	return item, false
+}
+
+// Chan adapts the channel for the non-transactional consumers. The items are read from the channel on a
+// forked thread and sent to the Go channel returned, until the context is done. The Go channel is closed
+// then. Each item is peeked in a transaction and removed in another, only once it has been sent, so the
+// item being sent when the context is done stays in the channel.
+// > Note: The items are read from the read end of the channel, so it must not be read otherwise.
+// usage:
+// for event := range events.Chan(ctx) {
+// 	...
+// }
+func (ch *TChan[T]) Chan(ctx context.Context) <-chan T {
+	out := make(chan T)
+	var item T
+	var end, next *stm.TVar[*tcons[T]]
+	peek := ch.stm.NewReadOnlyT().
+		DoErr(func(t *stm.Transaction) error {
+			if ch.read == nil {
+				return ErrWriteOnly
+			}
+			end = stm.ReadTVar(t, ch.read)
+			cons := stm.ReadTVar(t, end)
+			if cons == nil {
+				return t.Retry() // empty, wait for a writer
+			}
+			item, next = cons.value, cons.next
+			return nil
+		}).
+		Done("tchan")
+	advance := ch.stm.NewT().
+		DoErr(func(t *stm.Transaction) error {
+			if stm.ReadTVar(t, ch.read) != end {
+				return nil // already read past the item
+			}
+			if !stm.WriteTVar(t, ch.read, next) {
+				return stm.ErrConflict
+			}
+			return nil
+		}).
+		Done("tchan")
+	go func() {
+		defer close(out)
+		for {
+			if err := ch.stm.ExecContext(ctx, peek)[0]; err != nil {
+				return // the context is done, or the channel is write only
+			}
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				return // the item was not sent, it is left in the channel
+			}
+			if err := ch.stm.Exec(advance); err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
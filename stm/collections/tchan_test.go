@@ -0,0 +1,155 @@
+package collections
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+func TestTChanBroadcast(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := stm.NewSTM()
+		s.SetLockingMode(mode)
+		broadcast := NewBroadcastTChan[int](s)
+		dup := stm.DoneT(s.NewT(), func(tx *stm.Transaction) *TChan[int] { return broadcast.Dup(tx) })
+		first, _ := stm.ExecT(dup)
+		second, _ := stm.ExecT(dup)
+		read := s.NewT().DoErr(func(tx *stm.Transaction) error {
+			_, err := broadcast.Read(tx)
+			return err
+		}).Done()
+		if err := s.Exec(read); !errors.Is(err, ErrWriteOnly) {
+			t.Fatalf("%v: %v", mode, err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		out := second.Chan(ctx)
+		readers := make([]*stm.Transaction, 0)
+		for range 50 {
+			readers = append(readers, s.NewT().DoErr(func(tx *stm.Transaction) error {
+				_, err := first.Read(tx)
+				return err
+			}).Done())
+		}
+		fork := s.ForkAndExec(readers...)
+		// a rolled back write is never delivered
+		s.Exec(s.NewT().DoErr(func(tx *stm.Transaction) error {
+			if err := broadcast.Write(tx, 1000); err != nil {
+				return err
+			}
+			return errors.New("rolled back")
+		}).Done())
+		writers := make([]*stm.Transaction, 0)
+		for item := range 50 {
+			writers = append(writers, s.NewT().DoErr(func(tx *stm.Transaction) error {
+				return broadcast.Write(tx, item)
+			}).Done())
+		}
+		if err := s.Exec(writers...); err != nil {
+			t.Fatal(err)
+		}
+		if err := fork.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		sum := 0
+		for range 50 {
+			select {
+			case item := <-out:
+				sum += item
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%v: an item wasn't delivered", mode)
+			}
+		}
+		cancel()
+		for range out {
+		}
+		if sum != 49*50/2 {
+			t.Fatalf("%v: the items sum up to %d", mode, sum)
+		}
+		ch := NewTChan[string](s)
+		s.Exec(s.NewT().DoErr(func(tx *stm.Transaction) error { return ch.Write(tx, "x") }).Done())
+		var peeked, item string
+		var more bool
+		s.Exec(s.NewT().Do(func(tx *stm.Transaction) bool {
+			peeked, _ = ch.Peek(tx)
+			item, _, _ = ch.TryRead(tx)
+			_, more, _ = ch.TryRead(tx)
+			return true
+		}).Done())
+		if peeked != "x" || item != "x" || more {
+			t.Fatalf("%v: peeked %q, read %q, more %v", mode, peeked, item, more)
+		}
+	}
+}
+
+func TestTChanKeepsMemory(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := stm.NewSTM()
+		s.SetLockingMode(mode)
+		ch := NewTChan[int](s)
+		broadcast := NewBroadcastTChan[int](s)
+		cells := s.Stats().MemoryCells
+		write := s.NewT().DoErr(func(tx *stm.Transaction) error {
+			if err := ch.Write(tx, 1); err != nil {
+				return err
+			}
+			return broadcast.Write(tx, 1)
+		}).Done()
+		read := s.NewT().DoErr(func(tx *stm.Transaction) error {
+			_, err := ch.Read(tx)
+			return err
+		}).Done()
+		dup := stm.DoneT(s.NewT(), func(tx *stm.Transaction) *TChan[int] { return broadcast.Dup(tx) })
+		for range 100 {
+			if err := s.Exec(write, write, read, read); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stm.ExecT(dup); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the links and the duplicates' read ends are transient, the traffic never grows the STM's memory
+		if grown := s.Stats().MemoryCells - cells; grown != 0 {
+			t.Fatalf("%v: %d MemoryCells kept by the STM", mode, grown)
+		}
+	}
+}
+
+func TestTChanAdapterKeepsItemsOnCancel(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := stm.NewSTM()
+		s.SetLockingMode(mode)
+		ch := NewTChan[int](s)
+		for item := range 3 {
+			if err := s.Exec(s.NewT().DoErr(func(tx *stm.Transaction) error { return ch.Write(tx, item) }).Done()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		received := make([]int, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		out := ch.Chan(ctx)
+		received = append(received, <-out)
+		// the adapter is blocked sending the next item when cancelled
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		for item := range out {
+			received = append(received, item)
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		out = ch.Chan(ctx)
+		for len(received) < 3 {
+			item, ok := <-out
+			if !ok {
+				t.Fatalf("%v: items lost, received %v", mode, received)
+			}
+			received = append(received, item)
+		}
+		cancel()
+		if !slices.Equal(received, []int{0, 1, 2}) {
+			t.Fatalf("%v: received %v", mode, received)
+		}
+	}
+}
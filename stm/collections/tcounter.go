@@ -0,0 +1,60 @@
+/**
+* tcounter.go
+* @description Transactional counter, updated commutatively and striped over many `MemoryCell`s.
+ */
+
+package collections
+
+import (
+	"math/rand/v2"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+// TCounter is a transactional counter. `Add` is a commutative update, applied when committing without
+// reading the counter, so the transactions adding to the counter never conflict with each other.
+// The counter can be striped over many `TVar`s, each `Add` updates one of them at random, so that the
+// committing transactions don't wait for each other to update the same MemoryCell.
+// `stripes`: The TVars holding the parts of the count, the count is their sum
+type TCounter struct {
+	stripes []*stm.TVar[int64]
+}
+
+// NewTCounter makes a new `TCounter` on the STM, starting at 0, striped over the number of stripes,
+// 1 by default. `runtime.GOMAXPROCS(0)` stripes are a good fit for the hot counters.
+// usage:
+// requests := collections.NewTCounter(MySTM, runtime.GOMAXPROCS(0))
+func NewTCounter(s *stm.STM, stripes ...int) *TCounter {
+	counter := new(TCounter)
+	size := 1
+	if len(stripes) != 0 && stripes[0] > 0 {
+		size = stripes[0]
+	}
+	counter.stripes = make([]*stm.TVar[int64], size)
+	for i := range counter.stripes {
+		counter.stripes[i] = stm.NewTVar[int64](s, 0, stm.CloneValue)
+	}
+	return counter
+}
+
+// Add a transactional commutative update adding the delta to the counter. It never conflicts with the
+// other transactions adding to the counter, only with the transactions reading it.
+// usage:
+// DoErr(func(t *stm.Transaction) error {
+// 	requests.Add(t, 1)
+// 	...
+// })
+func (counter *TCounter) Add(t *stm.Transaction, delta int64) {
+	stripe := counter.stripes[rand.IntN(len(counter.stripes))]
+	stm.CommuteTVar(t, stripe, func(count int64) int64 { return count + delta })
+}
+
+// Value a transactional read of the count. All the stripes are read, so the transaction conflicts with
+// the transactions adding to the counter.
+func (counter *TCounter) Value(t *stm.Transaction) int64 {
+	count := int64(0)
+	for _, stripe := range counter.stripes {
+		count += stm.ReadTVar(t, stripe)
+	}
+	return count
+}
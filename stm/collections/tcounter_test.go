@@ -0,0 +1,44 @@
+package collections
+
+import (
+	"testing"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+func TestTCounter(t *testing.T) {
+	for _, stripes := range []int{1, 4} {
+		for _, mode := range lockingModes {
+			s := stm.NewSTM()
+			s.SetLockingMode(mode)
+			counter := NewTCounter(s, stripes)
+			add := s.NewT().Do(func(tx *stm.Transaction) bool {
+				counter.Add(tx, 2)
+				return true
+			}).Done()
+			ts := make([]*stm.Transaction, 200)
+			for i := range ts {
+				ts[i] = add
+			}
+			if err := s.Exec(ts...); err != nil {
+				t.Fatal(err)
+			}
+			// the transaction reads its own commutative updates
+			var own int64
+			s.Exec(s.NewT().Do(func(tx *stm.Transaction) bool {
+				counter.Add(tx, 1)
+				own = counter.Value(tx)
+				counter.Add(tx, 1)
+				return true
+			}).Done())
+			value, _ := stm.ExecT(stm.DoneT(s.NewT(), counter.Value))
+			if value != 402 || own != 401 {
+				t.Fatalf("%d stripes, %v: value %d, read its own %d", stripes, mode, value, own)
+			}
+			// the additions never conflict with each other
+			if add.Stats().Aborts[stm.AbortOwnershipConflict]+add.Stats().Aborts[stm.AbortReadValidation] != 0 {
+				t.Fatalf("%d stripes, %v: aborts %v", stripes, mode, add.Stats().Aborts)
+			}
+		}
+	}
+}
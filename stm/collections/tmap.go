@@ -0,0 +1,146 @@
+/**
+* tmap.go
+* @description Transactional hash map built on top of per-bucket `MemoryCell`s.
+ */
+
+// Package collections provides transactional data structures built on top of the `MemoryCell`s of an
+// `stm.STM`. They are operated on inside the actions of transactions, just like `TVar`s, and are
+// spread over many MemoryCells, so the transactions operating on different parts of them don't conflict.
+// usage:
+// accounts := collections.NewTMap[string, int](MySTM)
+// MySTM.NewT().
+// 	DoErr(func(t *stm.Transaction) error {
+// 		balance, _ := accounts.Get(t, "alice")
+// 		return accounts.Put(t, "alice", balance+100)
+// 	}).
+// 	Done()
+package collections
+
+import (
+	"hash/maphash"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+// defaultBuckets is the number of buckets of a TMap made without specifying it.
+const defaultBuckets = 64
+
+// TMap is a transactional hash map. The entries are spread over a fixed number of buckets, each bucket
+// is a `TVar` of its own, so the transactions operating on keys in different buckets never conflict.
+// The values are copied as is, so they should be value types or never be modified once put.
+// `buckets`: The TVars holding the entries of each bucket
+// `seed`: The seed of the hash of the keys, picking their bucket
+type TMap[K comparable, V any] struct {
+	buckets []*stm.TVar[[]entry[K, V]]
+	seed    maphash.Seed
+}
+
+// entry is an entry of a TMap.
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// NewTMap makes a new empty `TMap` on the STM, with the number of buckets, 64 by default.
+// The number of buckets never changes, more buckets mean less conflicts between the transactions.
+// usage:
+// accounts := collections.NewTMap[string, int](MySTM, 1024)
+func NewTMap[K comparable, V any](s *stm.STM, buckets ...int) *TMap[K, V] {
+	tmap := new(TMap[K, V])
+	size := defaultBuckets
+	if len(buckets) != 0 && buckets[0] > 0 {
+		size = buckets[0]
+	}
+	tmap.buckets = make([]*stm.TVar[[]entry[K, V]], size)
+	for i := range tmap.buckets {
+		tmap.buckets[i] = stm.NewTVar(s, []entry[K, V]{}, stm.CloneSlice[[]entry[K, V]])
+	}
+	tmap.seed = maphash.MakeSeed()
+	return tmap
+}
+
+// bucket gets the TVar of the bucket of the key.
+func (tmap *TMap[K, V]) bucket(key K) *stm.TVar[[]entry[K, V]] {
+	return tmap.buckets[maphash.Comparable(tmap.seed, key)%uint64(len(tmap.buckets))]
+}
+
+// Get a transactional read of the value of the key. Returns false when the key is not in the map.
+// Only the bucket of the key is read.
+func (tmap *TMap[K, V]) Get(t *stm.Transaction, key K) (value V, ok bool) {
+	for _, e := range stm.ReadTVar(t, tmap.bucket(key)) {
+		if e.key == key {
+			return e.value, true
+		}
+	}
+	return value, false
+}
+
+// Put a transactional write of the value of the key, adding the key when it is not in the map.
+// Only the bucket of the key is read and written. Returns `stm.ErrConflict` when the transaction
+// couldn't take the ownership of the bucket, the action should return it so that the transaction retries.
+func (tmap *TMap[K, V]) Put(t *stm.Transaction, key K, value V) error {
+	bucket := tmap.bucket(key)
+	entries := stm.ReadTVar(t, bucket)
+	found := false
+	for i := range entries {
+		if entries[i].key == key {
+			entries[i].value = value
+			found = true
+			break
+		}
+	}
+	if !found {
+		entries = append(entries, entry[K, V]{key: key, value: value})
+	}
+	if !stm.WriteTVar(t, bucket, entries) {
+		return stm.ErrConflict
+	}
+	return nil
+}
+
+// Delete a transactional removal of the key from the map. Returns false when the key is not in the map,
+// in which case nothing is written. Returns `stm.ErrConflict` when the transaction couldn't take the
+// ownership of the bucket, the action should return it so that the transaction retries.
+func (tmap *TMap[K, V]) Delete(t *stm.Transaction, key K) (bool, error) {
+	bucket := tmap.bucket(key)
+	entries := stm.ReadTVar(t, bucket)
+	for i := range entries {
+		if entries[i].key != key {
+			continue
+		}
+		if !stm.WriteTVar(t, bucket, append(entries[:i], entries[i+1:]...)) {
+			return true, stm.ErrConflict
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Range a transactional read of all the entries of the map, calling the function for each of them in
+// no particular order, until it returns false. All the buckets visited are read, so the transaction
+// conflicts with the transactions writing to any of them.
+// usage:
+// total := 0
+// accounts.Range(t, func(name string, balance int) bool {
+// 	total += balance
+// 	return true
+// })
+func (tmap *TMap[K, V]) Range(t *stm.Transaction, fn func(key K, value V) bool) {
+	for _, bucket := range tmap.buckets {
+		for _, e := range stm.ReadTVar(t, bucket) {
+			if !fn(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// Len a transactional read of the number of entries in the map. All the buckets are read, so the
+// transaction conflicts with the transactions adding or removing any key.
+func (tmap *TMap[K, V]) Len(t *stm.Transaction) int {
+	size := 0
+	for _, bucket := range tmap.buckets {
+		size += len(stm.ReadTVar(t, bucket))
+	}
+	return size
+}
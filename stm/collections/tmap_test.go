@@ -0,0 +1,48 @@
+package collections
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+func TestTMap(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := stm.NewSTM()
+		s.SetLockingMode(mode)
+		tmap := NewTMap[string, int](s, 8)
+		ts := make([]*stm.Transaction, 0)
+		for i := range 400 {
+			key := fmt.Sprint("k", i%10)
+			ts = append(ts, s.NewT().DoErr(func(tx *stm.Transaction) error {
+				value, _ := tmap.Get(tx, key)
+				return tmap.Put(tx, key, value+1)
+			}).Done())
+		}
+		if err := s.Exec(ts...); err != nil {
+			t.Fatal(err)
+		}
+		total, size := 0, 0
+		err := s.Exec(s.NewT().DoErr(func(tx *stm.Transaction) error {
+			total, size = 0, tmap.Len(tx)
+			tmap.Range(tx, func(key string, value int) bool {
+				total += value
+				return true
+			})
+			_, err := tmap.Delete(tx, "k3")
+			return err
+		}).Done())
+		if err != nil || total != 400 || size != 10 {
+			t.Fatalf("%v: %d entries, total %d, %v", mode, size, total, err)
+		}
+		found, err := stm.ExecT(stm.DoneT(s.NewT(), func(tx *stm.Transaction) bool {
+			_, ok := tmap.Get(tx, "k3")
+			size = tmap.Len(tx)
+			return ok
+		}))
+		if err != nil || found || size != 9 {
+			t.Fatalf("%v: the key wasn't deleted, %d entries", mode, size)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/**
+* tqueue.go
+* @description Transactional FIFO queue, bounded or unbounded, with its front and back in separate `MemoryCell`s.
+ */
+
+package collections
+
+import "github.com/sidmishraw/stm-reworked/stm"
+
+// TQueue is a transactional FIFO queue. The items are kept in two immutable lists, the front, in order,
+// read by the consumers and the back, in reverse order, written by the producers. Each list is a `TVar`
+// of its own, so the producers and the consumers conflict only when the front runs out and the back is
+// moved over to it. A bounded queue keeps its free capacity split the same way.
+// The items are copied as is, so they should be value types or never be modified once pushed.
+// `front`: The items to be popped first, in order
+// `back`: The items pushed since the front was last refilled, in reverse order
+// `freed`: The capacity freed by the consumers, not yet handed over to the producers, nil when unbounded
+// `free`: The capacity left for the producers, nil when unbounded
+type TQueue[T any] struct {
+	front *stm.TVar[*list[T]]
+	back  *stm.TVar[*list[T]]
+	freed *stm.TVar[int]
+	free  *stm.TVar[int]
+}
+
+// list is an immutable singly linked list of the items of a TQueue.
+type list[T any] struct {
+	value T
+	next  *list[T]
+}
+
+// NewTQueue makes a new empty `TQueue` on the STM. The queue is bounded when a positive capacity
+// is passed, else it is unbounded.
+// usage:
+// orders := collections.NewTQueue[Order](MySTM)     // unbounded
+// jobs := collections.NewTQueue[Job](MySTM, 100)    // holds 100 jobs at most
+func NewTQueue[T any](s *stm.STM, capacity ...int) *TQueue[T] {
+	queue := new(TQueue[T])
+	queue.front = stm.NewTVar[*list[T]](s, nil, stm.CloneValue)
+	queue.back = stm.NewTVar[*list[T]](s, nil, stm.CloneValue)
+	if len(capacity) != 0 && capacity[0] > 0 {
+		queue.freed = stm.NewTVar(s, 0, stm.CloneValue)
+		queue.free = stm.NewTVar(s, capacity[0], stm.CloneValue)
+	}
+	return queue
+}
+
+// Push a transactional write adding the item to the back of the queue. When the bounded queue is full,
+// the transaction retries, blocking until an item is popped. Returns `stm.ErrRetry` in that case, or
+// `stm.ErrConflict` when the transaction couldn't take the ownership of the queue's MemoryCells, the
+// action should return it.
+// usage:
+// DoErr(func(t *stm.Transaction) error {
+// 	return jobs.Push(t, job)
+// })
+func (queue *TQueue[T]) Push(t *stm.Transaction, item T) error {
+	if queue.free != nil {
+		free := stm.ReadTVar(t, queue.free)
+		if free == 0 {
+			// take over the capacity freed by the consumers
+			free = stm.ReadTVar(t, queue.freed)
+			if free == 0 {
+				return t.Retry() // full, wait for a consumer
+			}
+			if !stm.WriteTVar(t, queue.freed, 0) {
+				return stm.ErrConflict
+			}
+		}
+		if !stm.WriteTVar(t, queue.free, free-1) {
+			return stm.ErrConflict
+		}
+	}
+	back := stm.ReadTVar(t, queue.back)
+	if !stm.WriteTVar(t, queue.back, &list[T]{value: item, next: back}) {
+		return stm.ErrConflict
+	}
+	return nil
+}
+
+// Pop a transactional removal of the item at the front of the queue. When the queue is empty, the
+// transaction retries, blocking until an item is pushed, instead of spinning. Returns `stm.ErrRetry`
+// in that case, or `stm.ErrConflict` when the transaction couldn't take the ownership of the queue's
+// MemoryCells, the action should return it.
+// usage:
+// DoErr(func(t *stm.Transaction) error {
+// 	job, err := jobs.Pop(t)
+// 	if err != nil {
+// 		return err
+// 	}
+// 	...
+// })
+func (queue *TQueue[T]) Pop(t *stm.Transaction) (item T, err error) {
+	item, ok, err := queue.TryPop(t)
+	if err == nil && !ok {
+		err = t.Retry() // empty, wait for a producer
+	}
+	return item, err
+}
+
+// TryPop a transactional removal of the item at the front of the queue, just like `Pop`, but it returns
+// false right away when the queue is empty.
+func (queue *TQueue[T]) TryPop(t *stm.Transaction) (item T, ok bool, err error) {
+	front := stm.ReadTVar(t, queue.front)
+	if front == nil {
+		//# refill the front with the back
+		back := stm.ReadTVar(t, queue.back)
+		if back == nil {
+			return item, false, nil
+		}
+		for ; back != nil; back = back.next {
+			front = &list[T]{value: back.value, next: front}
+		}
+		if !stm.WriteTVar[*list[T]](t, queue.back, nil) {
+			return item, false, stm.ErrConflict
+		}
+		//# refill the front with the back
+	}
+	if !stm.WriteTVar(t, queue.front, front.next) {
+		return item, false, stm.ErrConflict
+	}
+	if queue.freed != nil {
+		if !stm.WriteTVar(t, queue.freed, stm.ReadTVar(t, queue.freed)+1) {
+			return item, false, stm.ErrConflict
+		}
+	}
+	return front.value, true, nil
+}
+
+// Peek a transactional read of the item at the front of the queue, without removing it. Returns false
+// when the queue is empty.
+func (queue *TQueue[T]) Peek(t *stm.Transaction) (item T, ok bool) {
+	if front := stm.ReadTVar(t, queue.front); front != nil {
+		return front.value, true
+	}
+	back := stm.ReadTVar(t, queue.back)
+	if back == nil {
+		return item, false
+	}
+	for back.next != nil {
+		back = back.next // the oldest item is at the end of the back
+	}
+	return back.value, true
+}
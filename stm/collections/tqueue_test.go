@@ -0,0 +1,84 @@
+package collections
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+func TestTQueueProducersConsumers(t *testing.T) {
+	for _, capacity := range []int{0, 3} {
+		for _, mode := range lockingModes {
+			s := stm.NewSTM()
+			s.SetLockingMode(mode)
+			queue := NewTQueue[int](s, capacity)
+			var mutex sync.Mutex
+			popped := make([]int, 0)
+			ts := make([]*stm.Transaction, 0)
+			for producer := range 4 {
+				for i := range 25 {
+					ts = append(ts, s.NewT().DoErr(func(tx *stm.Transaction) error {
+						return queue.Push(tx, producer*100+i)
+					}).Done())
+				}
+			}
+			for range 100 {
+				var item int
+				ts = append(ts, s.NewT().DoErr(func(tx *stm.Transaction) (err error) {
+					item, err = queue.Pop(tx)
+					return err
+				}).OnCommit(func() {
+					mutex.Lock()
+					popped = append(popped, item)
+					mutex.Unlock()
+				}).Done())
+			}
+			if err := s.Exec(ts...); err != nil {
+				t.Fatal(err)
+			}
+			// every item pushed is popped exactly once
+			slices.Sort(popped)
+			if len(slices.Compact(popped)) != 100 {
+				t.Fatalf("capacity %d, %v: popped %d distinct items", capacity, mode, len(popped))
+			}
+			empty, _ := stm.ExecT(stm.DoneT(s.NewT(), func(tx *stm.Transaction) bool {
+				_, ok := queue.Peek(tx)
+				return !ok
+			}))
+			if !empty {
+				t.Fatalf("capacity %d, %v: items left in the queue", capacity, mode)
+			}
+		}
+	}
+}
+
+func TestTQueueOrder(t *testing.T) {
+	s := stm.NewSTM()
+	queue := NewTQueue[int](s)
+	s.Exec(s.NewT().DoErr(func(tx *stm.Transaction) error {
+		for item := range 3 {
+			if err := queue.Push(tx, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Done())
+	var got []int
+	s.Exec(s.NewT().DoErr(func(tx *stm.Transaction) error {
+		got = nil
+		front, _ := queue.Peek(tx)
+		got = append(got, front)
+		for {
+			item, ok, err := queue.TryPop(tx)
+			if err != nil || !ok {
+				return err
+			}
+			got = append(got, item)
+		}
+	}).Done())
+	if !slices.Equal(got, []int{0, 0, 1, 2}) {
+		t.Fatalf("got %v", got)
+	}
+}
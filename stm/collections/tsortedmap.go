@@ -0,0 +1,192 @@
+/**
+* tsortedmap.go
+* @description Transactional ordered map, a skip list whose links are `MemoryCell`s of their own.
+ */
+
+package collections
+
+import (
+	"cmp"
+	"hash/maphash"
+	"math/bits"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+// maxLevel is the number of levels of the skip list of a TSortedMap.
+const maxLevel = 16
+
+// TSortedMap is a transactional ordered map. It is a skip list, each link between its nodes and each
+// value is a `TVar` of its own, so the transactions operating on different key ranges never conflict.
+// The searches read the links they follow, so the transactions reading a key range, say, using `Range`,
+// conflict with the transactions adding or removing keys in it and are validated as a consistent
+// snapshot when committing.
+// The values are copied as is, so they should be value types or never be modified once put.
+// The MemoryCells of the nodes are transient, the nodes removed, or made by the aborted attempts at adding
+// a key, are garbage collected.
+// `stm`: The STM the MemoryCells of the nodes are made on
+// `head`: The sentinel node before the smallest key, linked on all the levels
+// `compare`: Compares the keys, returns a negative number when a < b, 0 when a == b, else a positive number
+// `seed`: The seed of the hash of the keys, picking the level of their node
+type TSortedMap[K comparable, V any] struct {
+	stm     *stm.STM
+	head    *skipNode[K, V]
+	compare func(a, b K) int
+	seed    maphash.Seed
+}
+
+// skipNode is a node of the skip list of a TSortedMap.
+// `key`: The key of the node, it never changes
+// `value`: The value of the key
+// `next`: The links to the next node on each level the node is on
+type skipNode[K comparable, V any] struct {
+	key   K
+	value *stm.TVar[V]
+	next  []*stm.TVar[*skipNode[K, V]]
+}
+
+// NewTSortedMap makes a new empty `TSortedMap` on the STM, ordering the keys by their natural order.
+// usage:
+// bids := collections.NewTSortedMap[int, Order](MySTM)
+func NewTSortedMap[K cmp.Ordered, V any](s *stm.STM) *TSortedMap[K, V] {
+	return NewTSortedMapFunc[K, V](s, cmp.Compare[K])
+}
+
+// NewTSortedMapFunc makes a new empty `TSortedMap` on the STM, ordering the keys using the compare
+// function. It must return a negative number when a < b, 0 when a == b, else a positive number.
+// usage:
+// asks := collections.NewTSortedMapFunc[Price, Order](MySTM, Price.Compare)
+func NewTSortedMapFunc[K comparable, V any](s *stm.STM, compare func(a, b K) int) *TSortedMap[K, V] {
+	smap := new(TSortedMap[K, V])
+	smap.stm = s
+	smap.compare = compare
+	smap.seed = maphash.MakeSeed()
+	smap.head = new(skipNode[K, V])
+	smap.head.next = make([]*stm.TVar[*skipNode[K, V]], maxLevel)
+	for level := range smap.head.next {
+		smap.head.next[level] = stm.NewTVar[*skipNode[K, V]](s, nil, stm.CloneValue)
+	}
+	return smap
+}
+
+// levelOf gets the number of levels the node of the key is on. It depends only on the key, so that
+// every attempt at adding the key, including the scan, writes to the same links.
+func (smap *TSortedMap[K, V]) levelOf(key K) int {
+	// each level is half as likely as the one below
+	return 1 + bits.TrailingZeros64(maphash.Comparable(smap.seed, key)|1<<(maxLevel-1))
+}
+
+// search a transactional read of the links leading to the key. It gets, on each level, the last node
+// with a key less than the key and the first node on the bottom level with a key greater than or equal
+// to the key, nil when there is none.
+func (smap *TSortedMap[K, V]) search(t *stm.Transaction, key K) (preds [maxLevel]*skipNode[K, V], next *skipNode[K, V]) {
+	pred := smap.head
+	for level := maxLevel - 1; level >= 0; level-- {
+		for {
+			next = stm.ReadTVar(t, pred.next[level])
+			if next == nil || smap.compare(next.key, key) >= 0 {
+				break
+			}
+			pred = next
+		}
+		preds[level] = pred
+	}
+	return preds, next
+}
+
+// Get a transactional read of the value of the key. Returns false when the key is not in the map.
+func (smap *TSortedMap[K, V]) Get(t *stm.Transaction, key K) (value V, ok bool) {
+	if _, next := smap.search(t, key); next != nil && smap.compare(next.key, key) == 0 {
+		return stm.ReadTVar(t, next.value), true
+	}
+	return value, false
+}
+
+// Put a transactional write of the value of the key, adding the key when it is not in the map.
+// Returns `stm.ErrConflict` when the transaction couldn't take the ownership of the MemoryCells
+// written, the action should return it so that the transaction retries.
+func (smap *TSortedMap[K, V]) Put(t *stm.Transaction, key K, value V) error {
+	preds, next := smap.search(t, key)
+	if next != nil && smap.compare(next.key, key) == 0 {
+		if !stm.WriteTVar(t, next.value, value) {
+			return stm.ErrConflict
+		}
+		return nil
+	}
+	//# link a new node after the preds
+	// the new node is not reachable before the transaction commits, so its own links are made
+	// pointing to the nodes after the preds, instead of being written
+	node := new(skipNode[K, V])
+	node.key = key
+	node.value = stm.NewTransientTVar(smap.stm, value, stm.CloneValue)
+	node.next = make([]*stm.TVar[*skipNode[K, V]], smap.levelOf(key))
+	for level := range node.next {
+		node.next[level] = stm.NewTransientTVar(smap.stm, stm.ReadTVar(t, preds[level].next[level]), stm.CloneValue)
+	}
+	for level := range node.next {
+		if !stm.WriteTVar(t, preds[level].next[level], node) {
+			return stm.ErrConflict
+		}
+	}
+	//# link a new node after the preds
+	return nil
+}
+
+// Delete a transactional removal of the key from the map. Returns false when the key is not in the map,
+// in which case nothing is written. Returns `stm.ErrConflict` when the transaction couldn't take the
+// ownership of the MemoryCells written, the action should return it so that the transaction retries.
+func (smap *TSortedMap[K, V]) Delete(t *stm.Transaction, key K) (bool, error) {
+	preds, next := smap.search(t, key)
+	if next == nil || smap.compare(next.key, key) != 0 {
+		return false, nil
+	}
+	//# unlink the node from the preds
+	for level := range next.next {
+		if !stm.WriteTVar(t, preds[level].next[level], stm.ReadTVar(t, next.next[level])) {
+			return true, stm.ErrConflict
+		}
+	}
+	//# unlink the node from the preds
+	return true, nil
+}
+
+// Floor a transactional read of the greatest key less than or equal to the key, along with its value.
+// Returns false when there is no such key.
+func (smap *TSortedMap[K, V]) Floor(t *stm.Transaction, key K) (floor K, value V, ok bool) {
+	preds, next := smap.search(t, key)
+	if next != nil && smap.compare(next.key, key) == 0 {
+		return next.key, stm.ReadTVar(t, next.value), true
+	}
+	if pred := preds[0]; pred != smap.head {
+		return pred.key, stm.ReadTVar(t, pred.value), true
+	}
+	return floor, value, false
+}
+
+// Ceiling a transactional read of the least key greater than or equal to the key, along with its value.
+// Returns false when there is no such key.
+func (smap *TSortedMap[K, V]) Ceiling(t *stm.Transaction, key K) (ceiling K, value V, ok bool) {
+	if _, next := smap.search(t, key); next != nil {
+		return next.key, stm.ReadTVar(t, next.value), true
+	}
+	return ceiling, value, false
+}
+
+// Range a transactional read of the entries with keys between lo and hi, both inclusive, calling the
+// function for each of them in the order of their keys, until it returns false. All the links between
+// the entries are read, so the transaction conflicts with the transactions adding or removing keys in
+// the range.
+// usage:
+// bids.Range(t, 100, 105, func(price int, order Order) bool {
+// 	volume += order.Quantity
+// 	return true
+// })
+func (smap *TSortedMap[K, V]) Range(t *stm.Transaction, lo, hi K, fn func(key K, value V) bool) {
+	_, next := smap.search(t, lo)
+	for next != nil && smap.compare(next.key, hi) <= 0 {
+		if !fn(next.key, stm.ReadTVar(t, next.value)) {
+			return
+		}
+		next = stm.ReadTVar(t, next.next[0])
+	}
+}
@@ -0,0 +1,90 @@
+package collections
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+func TestTSortedMap(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := stm.NewSTM()
+		s.SetLockingMode(mode)
+		smap := NewTSortedMap[int, int](s)
+		ts := make([]*stm.Transaction, 0)
+		for _, key := range rand.Perm(200) {
+			ts = append(ts, s.NewT().DoErr(func(tx *stm.Transaction) error {
+				return smap.Put(tx, key*2, key)
+			}).Done())
+		}
+		if err := s.Exec(ts...); err != nil {
+			t.Fatal(err)
+		}
+		ts = ts[:0]
+		for key := range 100 {
+			ts = append(ts, s.NewT().DoErr(func(tx *stm.Transaction) error {
+				_, err := smap.Delete(tx, key*4)
+				return err
+			}).Done())
+		}
+		if err := s.Exec(ts...); err != nil {
+			t.Fatal(err)
+		}
+		var keys []int
+		var floor, ceiling int
+		s.Exec(s.NewT().Do(func(tx *stm.Transaction) bool {
+			keys = nil
+			smap.Range(tx, 0, 1000, func(key, value int) bool {
+				keys = append(keys, key)
+				return true
+			})
+			floor, _, _ = smap.Floor(tx, 9)
+			ceiling, _, _ = smap.Ceiling(tx, 7)
+			return true
+		}).Done())
+		if len(keys) != 100 || !slices.IsSorted(keys) || keys[0] != 2 || floor != 6 || ceiling != 10 {
+			t.Fatalf("%v: %d keys, floor %d, ceiling %d", mode, len(keys), floor, ceiling)
+		}
+	}
+}
+
+func TestTSortedMapChurnKeepsMemory(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := stm.NewSTM()
+		s.SetLockingMode(mode)
+		smap := NewTSortedMap[int, int](s)
+		cells := s.Stats().MemoryCells
+		churn := func(key int) *stm.Transaction {
+			return s.NewT().DoErr(func(tx *stm.Transaction) error {
+				if _, ok := smap.Get(tx, key); ok {
+					_, err := smap.Delete(tx, key)
+					return err
+				}
+				return smap.Put(tx, key, key)
+			}).Done()
+		}
+		ts := make([]*stm.Transaction, 0)
+		for key := range 8 {
+			ts = append(ts, churn(key), churn(key), churn(key))
+		}
+		for range 20 {
+			if err := s.Exec(ts...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the nodes are transient, adding and removing keys never grows the STM's memory
+		if grown := s.Stats().MemoryCells - cells; grown != 0 {
+			t.Fatalf("%v: %d MemoryCells kept by the STM", mode, grown)
+		}
+		// each key was added and removed as many times
+		empty, err := stm.ExecT(stm.DoneT(s.NewT(), func(tx *stm.Transaction) bool {
+			_, _, ok := smap.Ceiling(tx, 0)
+			return !ok
+		}))
+		if err != nil || !empty {
+			t.Fatalf("%v: keys left in the map", mode)
+		}
+	}
+}
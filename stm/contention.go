@@ -0,0 +1,287 @@
+/**
+* contention.go
+* @description Contention managers deciding how ownership conflicts between transactions are resolved.
+ */
+
+package stm
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+// ConflictResolution is the decision taken by a `ContentionManager` when a transaction
+// finds a MemoryCell it wants to own already owned by another transaction.
+type ConflictResolution int
+
+const (
+	// Wait makes the transaction wait for the returned duration, then try to take the ownership again.
+	Wait ConflictResolution = iota
+	// AbortSelf makes the transaction roll back and retry.
+	AbortSelf
+	// AbortOther takes the ownership away from the owner. The owner fails when it
+	// tries to commit or to write to the MemoryCell, then rolls back and retries.
+	AbortOther
+)
+
+// ContentionManager decides how the ownership conflicts between transactions are resolved.
+// The consumer can provide their own implementation using `Transaction`'s `Karma`, `StartTime`
+// and `IsWaiting`.
+type ContentionManager interface {
+	// ResolveConflict is called when the transaction `attacker` finds a MemoryCell owned by the
+	// transaction `owner`. `waits` is the number of times the attacker has already waited on this
+	// conflict. The duration is the time to wait for when the resolution is `Wait`.
+	ResolveConflict(attacker, owner *Transaction, waits int) (ConflictResolution, time.Duration)
+}
+
+// SetContentionManager sets the ContentionManager used by the transactions executed on the STM.
+// The ContentionManager must be set before executing any transactions.
+// usage:
+// MySTM.SetContentionManager(stm.NewBackoffManager(time.Microsecond, time.Millisecond, 10))
+func (stm *STM) SetContentionManager(manager ContentionManager) {
+	stm.contentionManager = manager
+}
+
+// SetWaitForOwner enables, or disables, waiting for the owners. When enabled, a transaction finding a
+// MemoryCell owned by another transaction blocks until the owner releases it, instead of consulting the
+// ContentionManager. The waits are tracked in a wait-for graph, a transaction aborts itself, instead of
+// waiting, when waiting would close a cycle - a deadlock.
+// Since the ownerships of the writeSet are taken in the order of the MemoryCells, cycles are possible only
+// with `EncounterTimeLocking`, where the ownerships are taken in the order the actions write.
+// usage:
+// MySTM.SetWaitForOwner(true)
+func (stm *STM) SetWaitForOwner(enabled bool) {
+	stm.waitForOwner = enabled
+}
+
+// awaitOwnership blocks until the owner of the MemoryCell releases it, then takes its ownership.
+// Returns false, without waiting, when waiting would close a cycle in the wait-for graph, or when the
+// context is done while waiting.
+func (t *Transaction) awaitOwnership(ctx context.Context, memcell *MemoryCell) bool {
+	for {
+		// register before checking the owner, so that no release is missed
+		released := t.stm.releases.register([]*MemoryCell{memcell})
+		owner := memcell.tryOwn(t)
+		if owner == t {
+			t.stm.releases.unregister([]*MemoryCell{memcell}, released)
+			return true
+		}
+		t.stm.stmMutex.Lock()
+		if t.stm.waitsForCycle(t, owner) {
+			t.stm.stmMutex.Unlock()
+			t.stm.releases.unregister([]*MemoryCell{memcell}, released)
+			t.metadata.blocker = memcell // waited for once rolled back, so that the owner can make progress
+			t.log(slog.LevelDebug, "waiting for the owner would deadlock, aborting", cellAttr(memcell))
+			return false
+		}
+		t.stm.waitsFor[t] = owner
+		t.stm.stmMutex.Unlock()
+		t.log(slog.LevelDebug, "waiting for the owner to release the cell", cellAttr(memcell))
+		t.contention.waiting.Store(true)
+		select {
+		case <-released:
+		case <-ctx.Done():
+		}
+		t.contention.waiting.Store(false)
+		t.stm.stmMutex.Lock()
+		delete(t.stm.waitsFor, t)
+		t.stm.stmMutex.Unlock()
+		t.stm.releases.unregister([]*MemoryCell{memcell}, released)
+		if ctx.Err() != nil {
+			t.log(slog.LevelDebug, "stopped waiting for the owner", cellAttr(memcell), "error", ctx.Err())
+			return false // the cancellation is reported by the next attempt
+		}
+	}
+}
+
+// awaitRelease blocks until the MemoryCell the `Transaction t` aborted on, to break a deadlock, is released
+// by its owner or the context is done. The transaction must have been rolled back, holding no ownerships,
+// otherwise restarting right away could take back the MemoryCells the owner is waiting for, over and over.
+func (t *Transaction) awaitRelease(ctx context.Context) {
+	defer t.enterPhase(WaitPhase)()
+	memcell := t.metadata.blocker
+	t.metadata.blocker = nil
+	released := t.stm.releases.register([]*MemoryCell{memcell})
+	defer t.stm.releases.unregister([]*MemoryCell{memcell}, released)
+	if memcell.owner.Load() == nil {
+		return
+	}
+	t.log(slog.LevelDebug, "waiting for the cell to be released before restarting", cellAttr(memcell))
+	select {
+	case <-released:
+	case <-ctx.Done():
+	}
+}
+
+// waitsForCycle checks if the transaction `waiter` waiting for `owner` closes a cycle in the wait-for graph.
+// Must be called while holding the stmMutex.
+func (stm *STM) waitsForCycle(waiter, owner *Transaction) bool {
+	for next := owner; next != nil; next = stm.waitsFor[next] {
+		if next == waiter {
+			return true
+		}
+	}
+	return false
+}
+
+//# Built-in contention managers
+
+// PassiveManager always aborts the attacker, which retries immediately. This is the default.
+type PassiveManager struct{}
+
+// NewPassiveManager makes a new PassiveManager.
+func NewPassiveManager() *PassiveManager {
+	return new(PassiveManager)
+}
+
+// ResolveConflict always aborts the attacker.
+func (manager *PassiveManager) ResolveConflict(attacker, owner *Transaction, waits int) (ConflictResolution, time.Duration) {
+	return AbortSelf, 0
+}
+
+// AggressiveManager always aborts the owner.
+type AggressiveManager struct{}
+
+// NewAggressiveManager makes a new AggressiveManager.
+func NewAggressiveManager() *AggressiveManager {
+	return new(AggressiveManager)
+}
+
+// ResolveConflict always aborts the owner.
+func (manager *AggressiveManager) ResolveConflict(attacker, owner *Transaction, waits int) (ConflictResolution, time.Duration) {
+	return AbortOther, 0
+}
+
+// BackoffManager makes the attacker wait with exponential backoff and jitter, doubling the wait
+// every time, from `min` up to `max`. The attacker aborts itself after waiting `maxWaits` times.
+type BackoffManager struct {
+	min      time.Duration
+	max      time.Duration
+	maxWaits int
+}
+
+// NewBackoffManager makes a new BackoffManager.
+func NewBackoffManager(min, max time.Duration, maxWaits int) *BackoffManager {
+	manager := new(BackoffManager)
+	manager.min = min
+	manager.max = max
+	manager.maxWaits = maxWaits
+	return manager
+}
+
+// ResolveConflict waits with exponential backoff, then aborts the attacker.
+func (manager *BackoffManager) ResolveConflict(attacker, owner *Transaction, waits int) (ConflictResolution, time.Duration) {
+	if waits >= manager.maxWaits {
+		return AbortSelf, 0
+	}
+	return Wait, backoff(manager.min, manager.max, waits)
+}
+
+// KarmaManager prioritizes the transactions that have done more work. The attacker aborts the owner
+// when its karma, plus the number of times it has waited, exceeds the owner's karma, else it waits.
+type KarmaManager struct {
+	interval time.Duration
+}
+
+// NewKarmaManager makes a new KarmaManager, the attacker waits for `interval` each time.
+func NewKarmaManager(interval time.Duration) *KarmaManager {
+	manager := new(KarmaManager)
+	manager.interval = interval
+	return manager
+}
+
+// ResolveConflict aborts the owner once the attacker's karma catches up, else waits.
+func (manager *KarmaManager) ResolveConflict(attacker, owner *Transaction, waits int) (ConflictResolution, time.Duration) {
+	if attacker.Karma()+int64(waits) > owner.Karma() {
+		return AbortOther, 0
+	}
+	return Wait, manager.interval
+}
+
+// PolkaManager combines the KarmaManager and the BackoffManager. The attacker waits with exponential
+// backoff as many times as the difference in karma, then aborts the owner.
+type PolkaManager struct {
+	min time.Duration
+	max time.Duration
+}
+
+// NewPolkaManager makes a new PolkaManager.
+func NewPolkaManager(min, max time.Duration) *PolkaManager {
+	manager := new(PolkaManager)
+	manager.min = min
+	manager.max = max
+	return manager
+}
+
+// ResolveConflict waits with exponential backoff until the attacker's karma catches up, then aborts the owner.
+func (manager *PolkaManager) ResolveConflict(attacker, owner *Transaction, waits int) (ConflictResolution, time.Duration) {
+	if attacker.Karma()+int64(waits) > owner.Karma() {
+		return AbortOther, 0
+	}
+	return Wait, backoff(manager.min, manager.max, waits)
+}
+
+// GreedyManager prioritizes the older transactions. The attacker aborts the owner when the owner is
+// younger, or when the owner is itself waiting on a conflict, else it waits for the owner.
+type GreedyManager struct {
+	interval time.Duration
+}
+
+// NewGreedyManager makes a new GreedyManager, the attacker waits for `interval` each time.
+func NewGreedyManager(interval time.Duration) *GreedyManager {
+	manager := new(GreedyManager)
+	manager.interval = interval
+	return manager
+}
+
+// ResolveConflict aborts a younger or waiting owner, else waits.
+func (manager *GreedyManager) ResolveConflict(attacker, owner *Transaction, waits int) (ConflictResolution, time.Duration) {
+	if attacker.StartTime().Before(owner.StartTime()) || owner.IsWaiting() {
+		return AbortOther, 0
+	}
+	return Wait, manager.interval
+}
+
+// TimestampManager prioritizes the older transactions. The attacker aborts the owner when the owner is
+// younger, else it waits for `interval` up to `maxWaits` times before aborting itself.
+type TimestampManager struct {
+	interval time.Duration
+	maxWaits int
+}
+
+// NewTimestampManager makes a new TimestampManager.
+func NewTimestampManager(interval time.Duration, maxWaits int) *TimestampManager {
+	manager := new(TimestampManager)
+	manager.interval = interval
+	manager.maxWaits = maxWaits
+	return manager
+}
+
+// ResolveConflict aborts a younger owner, else waits and finally aborts the attacker.
+func (manager *TimestampManager) ResolveConflict(attacker, owner *Transaction, waits int) (ConflictResolution, time.Duration) {
+	if attacker.StartTime().Before(owner.StartTime()) {
+		return AbortOther, 0
+	}
+	if waits >= manager.maxWaits {
+		return AbortSelf, 0
+	}
+	return Wait, manager.interval
+}
+
+// backoff computes the exponential backoff for the number of waits, with jitter.
+// The backoff doubles with every wait, from min up to max. The jitter picks a duration
+// between half the backoff and the full backoff.
+func backoff(min, max time.Duration, waits int) time.Duration {
+	delay := max
+	if waits < 32 && min<<waits < max {
+		delay = min << waits
+	}
+	if delay <= 1 {
+		return delay
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+//# Built-in contention managers
@@ -0,0 +1,206 @@
+package stm
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitingManager always waits on the conflicts, for the delay.
+type waitingManager struct {
+	delay time.Duration
+}
+
+func (manager waitingManager) ResolveConflict(attacker, owner *Transaction, waits int) (ConflictResolution, time.Duration) {
+	return Wait, manager.delay
+}
+
+// holdOwnership executes a transaction owning the TVar until release is closed, returns once it owns it.
+func holdOwnership(s *STM, tvar *TVar[int], release chan struct{}) *sync.WaitGroup {
+	owned := make(chan struct{})
+	var once sync.Once
+	holder := s.NewT().Do(func(tx *Transaction) bool {
+		if !WriteTVar(tx, tvar, ReadTVar(tx, tvar)+1) {
+			return false
+		}
+		if !tx.IsScanning {
+			once.Do(func() { close(owned) })
+			<-release
+		}
+		return true
+	}).Done()
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	holder.Go(wg)
+	<-owned
+	return wg
+}
+
+// execWithDeadline executes a transaction writing to the TVar, owned by another transaction, and checks
+// that it gives up soon after the deadline.
+func execWithDeadline(t *testing.T, s *STM, tvar *TVar[int]) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	attacker := s.NewT().Do(func(tx *Transaction) bool {
+		return WriteTVar(tx, tvar, 100)
+	}).Done()
+	start := time.Now()
+	err := s.ExecContext(ctx, attacker)[0]
+	if !errors.Is(err, ErrTimedOut) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("gave up %v after the deadline", elapsed)
+	}
+}
+
+func TestWaitOnConflictHonoursContext(t *testing.T) {
+	s := NewSTM()
+	s.SetLockingMode(EncounterTimeLocking)
+	s.SetContentionManager(waitingManager{delay: time.Hour})
+	tvar := NewTVar(s, 0)
+	release := make(chan struct{})
+	wg := holdOwnership(s, tvar, release)
+	execWithDeadline(t, s, tvar)
+	close(release)
+	wg.Wait()
+	if value := readTVar(s, tvar); value != 1 {
+		t.Fatalf("the owner committed %d", value)
+	}
+}
+
+func TestWaitForOwnerHonoursContext(t *testing.T) {
+	// the ownerships are held while executing the actions, the waits are when taking them and when writing
+	for _, mode := range []LockingMode{ScanLocking, EncounterTimeLocking} {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		s.SetWaitForOwner(true)
+		tvar := NewTVar(s, 0)
+		release := make(chan struct{})
+		wg := holdOwnership(s, tvar, release)
+		execWithDeadline(t, s, tvar)
+		s.stmMutex.Lock()
+		waits := len(s.waitsFor)
+		s.stmMutex.Unlock()
+		if waits != 0 {
+			t.Fatalf("%v: %d edges left in the wait-for graph", mode, waits)
+		}
+		close(release)
+		wg.Wait()
+	}
+}
+
+func TestContentionManagers(t *testing.T) {
+	managers := []ContentionManager{
+		NewPassiveManager(),
+		NewAggressiveManager(),
+		NewBackoffManager(time.Microsecond, time.Millisecond, 8),
+		NewKarmaManager(50 * time.Microsecond),
+		NewPolkaManager(time.Microsecond, time.Millisecond),
+		NewGreedyManager(time.Microsecond),
+		NewTimestampManager(time.Microsecond, 10),
+	}
+	for _, manager := range managers {
+		for _, mode := range lockingModes {
+			s := NewSTM()
+			s.SetContentionManager(manager)
+			s.SetLockingMode(mode)
+			a, b := NewTVar(s, 0), NewTVar(s, 0)
+			ts := make([]*Transaction, 0)
+			for i := range 100 {
+				// half of the transactions write in the opposite order
+				x, y := a, b
+				if i%2 == 0 {
+					x, y = b, a
+				}
+				ts = append(ts, s.NewT().Do(func(tx *Transaction) bool {
+					return WriteTVar(tx, x, ReadTVar(tx, x)+1) && WriteTVar(tx, y, ReadTVar(tx, y)+1)
+				}).Done())
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			for _, err := range s.ExecContext(ctx, ts...) {
+				if err != nil {
+					t.Fatalf("%T, %v: %v", manager, mode, err)
+				}
+			}
+			cancel()
+			if readTVar(s, a) != 100 || readTVar(s, b) != 100 {
+				t.Fatalf("%T, %v: lost updates, %d and %d", manager, mode, readTVar(s, a), readTVar(s, b))
+			}
+		}
+	}
+}
+
+func TestWaitForOwnerBreaksDeadlocks(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetWaitForOwner(true)
+		s.SetLockingMode(mode)
+		tvars := []*TVar[int]{NewTVar(s, 0), NewTVar(s, 0), NewTVar(s, 0)}
+		ts := make([]*Transaction, 0)
+		for i := range 60 {
+			order := []int{i % 3, (i + 1) % 3, (i + 2) % 3}
+			if i%2 == 0 {
+				slices.Reverse(order)
+			}
+			ts = append(ts, s.NewT().Do(func(tx *Transaction) bool {
+				for _, k := range order {
+					if !WriteTVar(tx, tvars[k], ReadTVar(tx, tvars[k])+1) {
+						return false
+					}
+					time.Sleep(5 * time.Microsecond)
+				}
+				return true
+			}).Done())
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		for _, err := range s.ExecContext(ctx, ts...) {
+			if err != nil {
+				t.Fatalf("%v: %v", mode, err)
+			}
+		}
+		cancel()
+		for _, tvar := range tvars {
+			if value := readTVar(s, tvar); value != 60 {
+				t.Fatalf("%v: lost updates, %d", mode, value)
+			}
+		}
+		s.stmMutex.Lock()
+		waits := len(s.waitsFor)
+		s.stmMutex.Unlock()
+		if waits != 0 {
+			t.Fatalf("%v: %d edges left in the wait-for graph", mode, waits)
+		}
+	}
+}
+
+func TestOwnershipStealing(t *testing.T) {
+	s := NewSTM()
+	s.SetLockingMode(EncounterTimeLocking)
+	s.SetContentionManager(NewAggressiveManager())
+	tvar := NewTVar(s, 0)
+	p := newPausing()
+	runs := 0
+	victim := s.NewT().Do(func(tx *Transaction) bool {
+		runs++
+		if !WriteTVar(tx, tvar, ReadTVar(tx, tvar)+1) {
+			return false
+		}
+		p.pause(tx) // owning the TVar
+		return true
+	}).Done()
+	attacker := s.NewT().Do(func(tx *Transaction) bool {
+		return WriteTVar(tx, tvar, ReadTVar(tx, tvar)+100)
+	}).Done()
+	p.interleave(t, s, victim, attacker)
+	if value := readTVar(s, tvar); value != 101 {
+		t.Fatalf("lost an update, %d", value)
+	}
+	// the victim lost the ownership while paused, it ran again
+	if runs < 2 {
+		t.Fatalf("the ownership wasn't stolen, %d runs", runs)
+	}
+}
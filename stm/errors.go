@@ -0,0 +1,42 @@
+/**
+* errors.go
+* @description Errors reported by the STM when executing transactions.
+ */
+
+package stm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrConflict signals that the transaction ran into a conflict and should be rolled back and retried.
+// Actions chained using `DoErr` return it, or an error wrapping it, to request a retry.
+var ErrConflict = errors.New("stm: transaction conflict")
+
+// errInconsistentRead aborts the execution of a transaction that read a MemoryCell committed after its snapshot.
+var errInconsistentRead = fmt.Errorf("%w: inconsistent read", ErrConflict)
+
+// ErrRetry signals that the transaction has called `Retry` and must wait for its readSet to change
+// before executing again.
+var ErrRetry = errors.New("stm: transaction retry")
+
+// ErrReadOnly is reported when a read only transaction tries to write to a MemoryCell.
+var ErrReadOnly = errors.New("stm: write in a read only transaction")
+
+// ErrCancelled is reported when a transaction stopped retrying because its context was cancelled.
+var ErrCancelled = errors.New("stm: transaction cancelled")
+
+// ErrTimedOut is reported when a transaction stopped retrying because its context's deadline expired.
+var ErrTimedOut = errors.New("stm: transaction timed out")
+
+// contextError makes the error reported by the transaction named `name` when the context is done.
+// The error wraps both, `ErrCancelled` or `ErrTimedOut`, and the context's error.
+func contextError(name string, ctx context.Context) error {
+	reason := ErrCancelled
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		reason = ErrTimedOut
+	}
+	return fmt.Errorf("%s: %w: %w", name, reason, ctx.Err())
+}
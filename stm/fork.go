@@ -0,0 +1,144 @@
+/**
+* fork.go
+* @description Handles of the transactions forked using `ForkAndExec`.
+ */
+
+package stm
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// Status is the status of a transaction executed using `ForkAndExec`.
+type Status int
+
+const (
+	// StatusRunning the transaction is still executing.
+	StatusRunning Status = iota
+	// StatusCommitted the transaction has committed.
+	StatusCommitted
+	// StatusFailed the transaction has failed with a non-retryable error.
+	StatusFailed
+	// StatusCancelled the transaction was stopped, because the Fork was cancelled or its context was done.
+	StatusCancelled
+)
+
+// String gets the name of the status.
+func (status Status) String() string {
+	switch status {
+	case StatusRunning:
+		return "running"
+	case StatusCommitted:
+		return "committed"
+	case StatusFailed:
+		return "failed"
+	case StatusCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// Fork is the handle of the transactions executing on a forked thread.
+// `mutex`: Guards the statuses and errors, they are set as each transaction finishes
+// `statuses`: The status of each transaction, in the order they were passed
+// `errs`: The outcome of each transaction, in the order they were passed, the same as `ExecContext`
+// `executions`: The execution of each transaction, in the order they were passed
+// `done`: Closed once all the transactions have finished executing
+// `cancel`: Cancels the context the transactions are executed with
+type Fork struct {
+	mutex      sync.Mutex
+	statuses   []Status
+	errs       []error
+	executions []*Transaction
+	done       chan struct{}
+	cancel     context.CancelFunc
+}
+
+// ForkAndExecContext forks from the calling thread and executes all the transactions on the forked thread,
+// just like `ForkAndExec`, but the transactions stop retrying as soon as the context is done.
+func (stm *STM) ForkAndExecContext(ctx context.Context, ts ...*Transaction) *Fork {
+	fork := new(Fork)
+	fork.statuses = make([]Status, len(ts))
+	fork.errs = make([]error, len(ts))
+	fork.executions = make([]*Transaction, len(ts))
+	fork.done = make(chan struct{})
+	ctx, fork.cancel = context.WithCancel(ctx)
+	wg := new(sync.WaitGroup)
+	for i, t := range ts {
+		fork.executions[i] = t.execution()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fork.finish(i, fork.executions[i].run(ctx))
+		}()
+	}
+	go func() {
+		wg.Wait()
+		fork.cancel() // release the context's resources
+		close(fork.done)
+	}()
+	return fork
+}
+
+// finish records the outcome of the i-th transaction.
+func (fork *Fork) finish(i int, err error) {
+	fork.mutex.Lock()
+	defer fork.mutex.Unlock()
+	fork.errs[i] = err
+	switch {
+	case err == nil:
+		fork.statuses[i] = StatusCommitted
+	case errors.Is(err, ErrCancelled) || errors.Is(err, ErrTimedOut):
+		fork.statuses[i] = StatusCancelled
+	default:
+		fork.statuses[i] = StatusFailed
+	}
+}
+
+// Done gets a channel that is closed once all the transactions have finished executing, for using in `select`.
+// usage:
+// select {
+// case <-fork.Done():
+// case <-time.After(time.Second):
+// 	fork.Cancel()
+// }
+func (fork *Fork) Done() <-chan struct{} {
+	return fork.done
+}
+
+// Wait blocks until all the transactions have finished executing. It returns the first non-nil outcome
+// of the transactions, in the order they were passed, the same as `Exec`.
+func (fork *Fork) Wait() error {
+	<-fork.done
+	for _, err := range fork.Errs() {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cancel stops the transactions that are still executing. They are rolled back and stop retrying,
+// their outcome wraps `ErrCancelled`. The transactions that have already committed are not affected.
+// Cancel doesn't wait for the transactions to stop, use `Wait` or `Done` for that.
+func (fork *Fork) Cancel() {
+	fork.cancel()
+}
+
+// Statuses gets the current status of each transaction, in the order they were passed.
+func (fork *Fork) Statuses() []Status {
+	fork.mutex.Lock()
+	defer fork.mutex.Unlock()
+	return slices.Clone(fork.statuses)
+}
+
+// Errs gets the outcome of each transaction, in the order they were passed: `nil` when the transaction
+// committed or is still executing, else the error it was stopped or failed with.
+func (fork *Fork) Errs() []error {
+	fork.mutex.Lock()
+	defer fork.mutex.Unlock()
+	return slices.Clone(fork.errs)
+}
@@ -0,0 +1,33 @@
+package stm
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestForkCancel(t *testing.T) {
+	s := NewSTM()
+	tvar := NewTVar(s, 0)
+	blocked := s.NewT().DoErr(func(tx *Transaction) error {
+		if ReadTVar(tx, tvar) == 0 {
+			return tx.Retry()
+		}
+		return nil
+	}).Done()
+	ok := s.NewT().Do(func(tx *Transaction) bool { return true }).Done()
+	fork := s.ForkAndExec(ok, blocked)
+	time.Sleep(20 * time.Millisecond)
+	if statuses := fork.Statuses(); statuses[0] != StatusCommitted || statuses[1] != StatusRunning {
+		t.Fatalf("statuses %v", statuses)
+	}
+	fork.Cancel()
+	select {
+	case <-fork.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the fork wasn't cancelled")
+	}
+	if err := fork.Wait(); !errors.Is(err, ErrCancelled) || fork.Statuses()[1] != StatusCancelled {
+		t.Fatalf("%v, statuses %v", err, fork.Statuses())
+	}
+}
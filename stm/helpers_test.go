@@ -0,0 +1,19 @@
+package stm
+
+import "errors"
+
+// lockingModes are all the locking modes, the tests run in each of them.
+var lockingModes = []LockingMode{ScanLocking, EncounterTimeLocking, CommitTimeLocking}
+
+// errPermanent is a non-retryable error returned by the actions of the tests.
+var errPermanent = errors.New("permanent")
+
+// readTVar reads the latest value of the TVar, in a transaction of its own.
+func readTVar[T any](s *STM, tvar *TVar[T]) T {
+	var value T
+	s.Exec(s.NewT().Do(func(tx *Transaction) bool {
+		value = ReadTVar(tx, tvar)
+		return true
+	}).Done())
+	return value
+}
@@ -0,0 +1,104 @@
+/**
+* hooks.go
+* @description Lifecycle hooks run when transactions commit, abort or retry.
+ */
+
+package stm
+
+// hooks holds the lifecycle hooks of a transaction, registered on its `TransactionContext`.
+// `onCommit`: Run after the transaction commits
+// `onAbort`: Run after an attempt at executing the transaction is rolled back, with the reason
+// `onRetry`: Run after the transaction is rolled back because an action called `Retry`, before it blocks
+type hooks struct {
+	onCommit []func()
+	onAbort  []func(AbortReason)
+	onRetry  []func()
+}
+
+// Observer observes the lifecycle of all the transactions executed on the STM. The hooks that are nil
+// are skipped. The hooks are run on the goroutine executing the transaction, after the transaction's
+// own hooks, so they must not block.
+// `OnCommit`: Run after a transaction commits
+// `OnAbort`: Run after an attempt at executing a transaction is rolled back, with the reason
+// `OnRetry`: Run after a transaction is rolled back because an action called `Retry`, before it blocks
+type Observer struct {
+	OnCommit func(t *Transaction)
+	OnAbort  func(t *Transaction, reason AbortReason)
+	OnRetry  func(t *Transaction)
+}
+
+// AddObserver adds an observer of the lifecycle of all the transactions executed on the STM.
+// The observers must be added before executing any transactions.
+// usage:
+// MySTM.AddObserver(stm.Observer{
+// 	OnAbort: func(t *stm.Transaction, reason stm.AbortReason) { aborts.WithLabelValues(reason.String()).Inc() },
+// })
+func (stm *STM) AddObserver(observer Observer) {
+	stm.observers = append(stm.observers, observer)
+}
+
+// OnCommit registers a hook run after the transaction commits. It is the place for side effects, like
+// sending a message, that must happen only once the transaction has really committed.
+// usage:
+// MySTM.NewT().
+// 	Do(func(t *stm.Transaction) bool {...}).
+// 	OnCommit(func() { notifications <- "transferred" }).
+// 	Done()
+func (tc *TransactionContext) OnCommit(hook func()) *TransactionContext {
+	tc.transaction.hooks.onCommit = append(tc.transaction.hooks.onCommit, hook)
+	return tc
+}
+
+// OnAbort registers a hook run after each aborted attempt at executing the transaction, once it has been
+// rolled back, with the reason it was aborted. The transaction is retried afterwards, unless the reason is
+// `AbortError` or `AbortCancelled`.
+func (tc *TransactionContext) OnAbort(hook func(reason AbortReason)) *TransactionContext {
+	tc.transaction.hooks.onAbort = append(tc.transaction.hooks.onAbort, hook)
+	return tc
+}
+
+// OnRetry registers a hook run after the transaction is rolled back because an action called `Retry`,
+// before it blocks waiting for its readSet to change.
+func (tc *TransactionContext) OnRetry(hook func()) *TransactionContext {
+	tc.transaction.hooks.onRetry = append(tc.transaction.hooks.onRetry, hook)
+	return tc
+}
+
+// committed counts the commit of the `Transaction t` and runs the OnCommit hooks.
+func (t *Transaction) committed() {
+	t.countCommit(int64(t.metadata.attempt - 1))
+	t.template.latest.Store(t.metadata.version)
+	for _, hook := range t.hooks.onCommit {
+		hook()
+	}
+	for _, observer := range t.stm.observers {
+		if observer.OnCommit != nil {
+			observer.OnCommit(t)
+		}
+	}
+}
+
+// aborted counts the aborted attempt at executing the `Transaction t` and runs the OnAbort hooks, followed
+// by the OnRetry hooks when an action called `Retry`. Must be called after rolling back.
+func (t *Transaction) aborted(reason AbortReason) {
+	t.countAbort(reason)
+	for _, hook := range t.hooks.onAbort {
+		hook(reason)
+	}
+	for _, observer := range t.stm.observers {
+		if observer.OnAbort != nil {
+			observer.OnAbort(t, reason)
+		}
+	}
+	if reason != AbortRetry {
+		return
+	}
+	for _, hook := range t.hooks.onRetry {
+		hook()
+	}
+	for _, observer := range t.stm.observers {
+		if observer.OnRetry != nil {
+			observer.OnRetry(t)
+		}
+	}
+}
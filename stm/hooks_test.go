@@ -0,0 +1,44 @@
+package stm
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	s := NewSTM()
+	var observedCommits, observedAborts, observedRetries atomic.Int64
+	s.AddObserver(Observer{
+		OnCommit: func(*Transaction) { observedCommits.Add(1) },
+		OnAbort:  func(*Transaction, AbortReason) { observedAborts.Add(1) },
+		OnRetry:  func(*Transaction) { observedRetries.Add(1) },
+	})
+	tvar := NewTVar(s, 0)
+	var commits, retries int
+	var reasons []AbortReason
+	waiter := s.NewT().
+		DoErr(func(tx *Transaction) error {
+			if ReadTVar(tx, tvar) == 0 {
+				return tx.Retry()
+			}
+			return nil
+		}).
+		OnCommit(func() { commits++ }).
+		OnRetry(func() { retries++ }).
+		OnAbort(func(reason AbortReason) { reasons = append(reasons, reason) }).
+		Done()
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	waiter.Go(wg)
+	time.Sleep(20 * time.Millisecond)
+	s.Exec(s.NewT().Do(func(tx *Transaction) bool { return WriteTVar(tx, tvar, 1) }).Done())
+	wg.Wait()
+	if commits != 1 || retries < 1 || len(reasons) == 0 || reasons[0] != AbortRetry {
+		t.Fatalf("hooks: %d commits, %d retries, aborts %v", commits, retries, reasons)
+	}
+	if observedCommits.Load() != 2 || observedRetries.Load() < 1 || observedAborts.Load() < 1 {
+		t.Fatalf("observers: %d commits, %d retries, %d aborts", observedCommits.Load(), observedRetries.Load(), observedAborts.Load())
+	}
+}
@@ -0,0 +1,38 @@
+package stm
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	if NewSTM().logger != slog.Default() {
+		t.Fatal("the STM doesn't log through the default logger")
+	}
+	s := NewSTM()
+	var out strings.Builder
+	s.SetLogHandler(slog.NewTextHandler(&out, nil)) // slog.LevelInfo, just like the default
+	tvar := NewTVar(s, 0)
+	failing := s.NewT().DoErr(func(tx *Transaction) error {
+		WriteTVar(tx, tvar, 1)
+		return errPermanent
+	}).Done("failing")
+	committing := s.NewT().Do(func(tx *Transaction) bool {
+		return WriteTVar(tx, tvar, 2)
+	}).Done("committing")
+	s.Exec(failing, committing)
+	if out.Len() != 0 {
+		t.Fatalf("the transactions logged above the debug level: %s", out.String())
+	}
+	s.Log("balance", 100)
+	if !strings.Contains(out.String(), "level=INFO") || !strings.Contains(out.String(), `msg="balance 100"`) {
+		t.Fatalf("Log wrote %q", out.String())
+	}
+	out.Reset()
+	s.SetLogHandler(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s.Exec(committing)
+	if !strings.Contains(out.String(), "msg=committed") || !strings.Contains(out.String(), "transaction=committing") {
+		t.Fatalf("the trace is missing the commit: %s", out.String())
+	}
+}
@@ -4,26 +4,112 @@
 * @description Definitions of MemoryCell and its related methods/functions.
 * @created Wed Nov 22 2017 21:44:55 GMT-0800 (PST)
 * @copyright 2017 Sidharth Mishra
-* @last-modified Thu Nov 23 2017 18:37:01 GMT-0800 (PST)
+* @last-modified Fri Oct 16 2026 10:37:40 GMT+0000 (UTC)
  */
 
 package stm
 
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 // MemoryCell represents each memory cell that holds data.
-// `cellIndex`: The index or address of the `MemoryCell` in the `_Memory` vector of the STM.
+// `cellIndex`: The number of the `MemoryCell`, in the order the MemoryCells were made on the STM.
 // to be used internally
 // `data`: The data stored inside the `MemoryCell`
+// `version`: The commit timestamp of the transaction that wrote the data, 0 for the initial data
+// `history`: The older committed versions still needed by the read only snapshots, oldest first, at most
+// one for each active snapshot
+// `mutex`: Guards the data, version and history. It is held for writing by the committing transaction
+// for the whole commit, so the readers never see a commit half way through
+// `owner`: The transaction owning the MemoryCell, nil when it is not owned. It is only ever changed
+// using compare-and-swap, so taking and releasing the ownership never locks
+// `ownedAt`: When the owner took the ownership, in nanoseconds
 type MemoryCell struct {
 	cellIndex uint
 	data      Data
+	version   uint64
+	history   []cellVersion
+	mutex     sync.RWMutex
+	owner     atomic.Pointer[Transaction]
+	ownedAt   atomic.Int64
+}
+
+// cellVersion is an older committed version of the data held in a `MemoryCell`.
+type cellVersion struct {
+	data    Data
+	version uint64
 }
 
-// writeData writes the bytes into the byte buffer of the MemoryCell
+// writeData writes the data into the MemoryCell and stamps it with the version
 // usage:
-// status := memCell.writeData(Data([]int{1,2,3}))
-// if !status { log.Fataln("Faield to write!")}
-func (memCell *MemoryCell) writeData(data Data) {
+// memCell.writeData(Data([]int{1,2,3}), version)
+func (memCell *MemoryCell) writeData(data Data, version uint64) {
 	memCell.data = data
+	memCell.version = version
+}
+
+// commitData writes the data into the MemoryCell, keeping the current data in its history as long
+// as a snapshot might read it. `snapshots` are the versions of the active snapshots, in increasing order.
+// With no active snapshot, the current data is dropped right away.
+// Must be called while holding the MemoryCell's mutex for writing.
+func (memCell *MemoryCell) commitData(data Data, version uint64, snapshots []uint64) {
+	if len(snapshots) > 0 {
+		memCell.history = append(memCell.history, cellVersion{data: memCell.data, version: memCell.version})
+	}
+	memCell.writeData(data, version)
+	memCell.prune(snapshots)
+}
+
+// prune garbage collects the versions in the history that none of the snapshots read. A snapshot reads
+// the newest version that is not newer than itself, so a version is kept only when a snapshot falls in
+// between it and the version after it. The history never holds more versions than there are snapshots.
+// `snapshots` are the versions of the active snapshots, in increasing order.
+// Must be called while holding the MemoryCell's mutex for writing.
+func (memCell *MemoryCell) prune(snapshots []uint64) {
+	if len(memCell.history) == 0 {
+		return
+	}
+	memCell.history = slices.DeleteFunc(slices.Clone(memCell.history), func(old cellVersion) bool {
+		return !memCell.isRead(old.version, snapshots)
+	})
+	if len(memCell.history) == 0 {
+		memCell.history = nil // let go of the backing array
+	}
+}
+
+// isRead checks if any of the snapshots reads the version of the MemoryCell held in its history.
+// `snapshots` are the versions of the active snapshots, in increasing order.
+func (memCell *MemoryCell) isRead(version uint64, snapshots []uint64) bool {
+	next := memCell.version
+	for _, newer := range memCell.history {
+		if newer.version > version {
+			next = newer.version
+			break
+		}
+	}
+	// the oldest snapshot not older than the version must be older than the version after it
+	i, _ := slices.BinarySearch(snapshots, version)
+	return i < len(snapshots) && snapshots[i] < next
+}
+
+// readSnapshot reads the contents of the MemoryCell as of the snapshot, along with their version.
+func (memCell *MemoryCell) readSnapshot(snapshot uint64) (Data, uint64) {
+	memCell.mutex.RLock()
+	defer memCell.mutex.RUnlock()
+	if memCell.version <= snapshot {
+		return memCell.readData(), memCell.version
+	}
+	for i := len(memCell.history) - 1; i >= 0; i-- {
+		if memCell.history[i].version <= snapshot {
+			return memCell.history[i].data.Clone(), memCell.history[i].version
+		}
+	}
+	// the versions are kept while the snapshot is active, so this is never reached
+	return memCell.readData(), memCell.version
 }
 
 // readData reads the contents of the MemoryCell into the dataContainer
@@ -32,3 +118,55 @@ func (memCell *MemoryCell) writeData(data Data) {
 func (memCell *MemoryCell) readData() Data {
 	return memCell.data.Clone()
 }
+
+// tryOwn makes the transaction the owner of the MemoryCell, when it is not owned.
+// Returns the owner of the MemoryCell, the transaction itself when it has taken the ownership.
+func (memCell *MemoryCell) tryOwn(t *Transaction) *Transaction {
+	for {
+		if memCell.owner.CompareAndSwap(nil, t) {
+			memCell.ownedAt.Store(time.Now().UnixNano())
+			return t
+		}
+		if owner := memCell.owner.Load(); owner != nil {
+			return owner
+		}
+		// released in between, try again
+	}
+}
+
+// steal takes the ownership of the MemoryCell away from `owner`, giving it to the transaction.
+// Returns true when the ownership has been taken, false when the MemoryCell is no longer owned by `owner`.
+func (memCell *MemoryCell) steal(owner, t *Transaction) bool {
+	if !memCell.owner.CompareAndSwap(owner, t) {
+		return false
+	}
+	memCell.ownedAt.Store(time.Now().UnixNano())
+	return true
+}
+
+// release releases the ownership of the MemoryCell held by the transaction. Returns how long the
+// ownership was held for, and false when the transaction doesn't own the MemoryCell, say, because
+// it was taken away.
+func (memCell *MemoryCell) release(t *Transaction) (time.Duration, bool) {
+	ownedAt := memCell.ownedAt.Load() // only changes when the ownership changes
+	if !memCell.owner.CompareAndSwap(t, nil) {
+		return 0, false
+	}
+	return time.Since(time.Unix(0, ownedAt)), true
+}
+
+// readVersioned reads the contents of the MemoryCell along with their version. It blocks while the
+// MemoryCell is being committed.
+func (memCell *MemoryCell) readVersioned() (Data, uint64) {
+	memCell.mutex.RLock()
+	defer memCell.mutex.RUnlock()
+	return memCell.readData(), memCell.version
+}
+
+// currentVersion gets the version of the contents of the MemoryCell. It blocks while the MemoryCell
+// is being committed.
+func (memCell *MemoryCell) currentVersion() uint64 {
+	memCell.mutex.RLock()
+	defer memCell.mutex.RUnlock()
+	return memCell.version
+}
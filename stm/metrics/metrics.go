@@ -0,0 +1,122 @@
+/**
+* metrics.go
+* @description Serves the statistics of an STM as metrics in the Prometheus text exposition format.
+ */
+
+// Package metrics exposes the statistics of an `stm.STM` to Prometheus.
+// usage:
+// http.Handle("/metrics", metrics.NewHandler(MySTM))
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+// contentType is the content type of the Prometheus text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler is an `http.Handler` serving the statistics of the STM as metrics in the Prometheus text
+// exposition format. The statistics are read when scraped.
+// `stm`: The STM whose statistics are served
+// `namespace`: The prefix of the names of the metrics
+type Handler struct {
+	stm       *stm.STM
+	namespace string
+}
+
+// NewHandler makes a new Handler serving the metrics of the STM. The names of the metrics are prefixed
+// with the namespace, `stm` by default.
+// usage:
+// http.Handle("/metrics", metrics.NewHandler(MySTM, "payments_stm"))
+func NewHandler(s *stm.STM, namespace ...string) *Handler {
+	handler := new(Handler)
+	handler.stm = s
+	handler.namespace = "stm"
+	if len(namespace) != 0 && namespace[0] != "" {
+		handler.namespace = namespace[0]
+	}
+	return handler
+}
+
+// ServeHTTP serves the metrics.
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	if err := Write(w, handler.namespace, handler.stm.Stats()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Write writes the statistics as metrics in the Prometheus text exposition format, the names of the
+// metrics are prefixed with the namespace.
+func Write(w io.Writer, namespace string, stats stm.Stats) error {
+	out := bufio.NewWriter(w)
+	//# counters
+	header(out, namespace, "attempts_total", "counter", "The number of attempts at executing transactions, including the retries.")
+	sample(out, namespace, "attempts_total", "", float64(stats.Attempts))
+	header(out, namespace, "commits_total", "counter", "The number of transactions committed.")
+	sample(out, namespace, "commits_total", "", float64(stats.Commits))
+	header(out, namespace, "aborts_total", "counter", "The number of aborted attempts at executing transactions, by reason.")
+	for _, reason := range slices.Sorted(maps.Keys(stats.Aborts)) {
+		sample(out, namespace, "aborts_total", label("reason", reason.String()), float64(stats.Aborts[reason]))
+	}
+	header(out, namespace, "phase_seconds_total", "counter", "The time spent by the transactions in each phase of their execution.")
+	for _, phase := range slices.Sorted(maps.Keys(stats.PhaseTimes)) {
+		sample(out, namespace, "phase_seconds_total", label("phase", phase.String()), stats.PhaseTimes[phase].Seconds())
+	}
+	//# counters
+	//# histograms
+	header(out, namespace, "retries", "histogram", "The number of aborted attempts before each commit.")
+	histogram(out, namespace, "retries", stats.Retries, 1)
+	header(out, namespace, "ownership_hold_seconds", "histogram", "How long the ownerships of the MemoryCells were held for.")
+	histogram(out, namespace, "ownership_hold_seconds", stats.OwnershipHolds, float64(time.Second))
+	//# histograms
+	//# gauges
+	header(out, namespace, "memory_cells", "gauge", "The number of MemoryCells in the STM.")
+	sample(out, namespace, "memory_cells", "", float64(stats.MemoryCells))
+	header(out, namespace, "owned_cells", "gauge", "The number of MemoryCells currently owned by transactions.")
+	sample(out, namespace, "owned_cells", "", float64(stats.OwnedCells))
+	//# gauges
+	return out.Flush()
+}
+
+// header writes the HELP and TYPE lines of the metric.
+func header(out *bufio.Writer, namespace, name, kind, help string) {
+	fmt.Fprintf(out, "# HELP %s_%s %s\n", namespace, name, help)
+	fmt.Fprintf(out, "# TYPE %s_%s %s\n", namespace, name, kind)
+}
+
+// sample writes a sample of the metric, the labels are already formatted.
+func sample(out *bufio.Writer, namespace, name, labels string, value float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(out, "%s_%s%s %s\n", namespace, name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// histogram writes the samples of the histogram, the cumulative buckets, the sum and the count.
+// The bounds and the sum are divided by the unit, say, to convert nanoseconds into seconds.
+func histogram(out *bufio.Writer, namespace, name string, buckets stm.Histogram, unit float64) {
+	cumulative := uint64(0)
+	for i, bound := range buckets.Bounds {
+		cumulative += buckets.Counts[i]
+		le := strconv.FormatFloat(float64(bound)/unit, 'g', -1, 64)
+		sample(out, namespace, name+"_bucket", label("le", le), float64(cumulative))
+	}
+	sample(out, namespace, name+"_bucket", label("le", "+Inf"), float64(buckets.Count))
+	sample(out, namespace, name+"_sum", "", float64(buckets.Sum)/unit)
+	sample(out, namespace, name+"_count", "", float64(buckets.Count))
+}
+
+// label formats the label, escaping its value.
+func label(name, value string) string {
+	return name + "=" + strconv.Quote(value)
+}
@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sidmishraw/stm-reworked/stm"
+)
+
+func TestHandler(t *testing.T) {
+	s := stm.NewSTM()
+	tvar := stm.NewTVar(s, 0)
+	s.Exec(s.NewT().Do(func(tx *stm.Transaction) bool { return stm.WriteTVar(tx, tvar, 1) }).Done())
+	recorder := httptest.NewRecorder()
+	NewHandler(s).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, metric := range []string{"stm_commits_total 1\n", "stm_memory_cells 1\n", "stm_ownership_hold_seconds_count 1\n"} {
+		if !strings.Contains(body, metric) {
+			t.Fatalf("missing %q in\n%s", metric, body)
+		}
+	}
+}
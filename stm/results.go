@@ -0,0 +1,127 @@
+/**
+* results.go
+* @description Transactions producing typed results, along with futures for awaiting them.
+ */
+
+package stm
+
+import "context"
+
+// TypedTransaction is a `Transaction` producing a result of type T when it commits.
+// It can be used wherever a Transaction is used through its embedded `Transaction`.
+// Each execution keeps its own result, so the same typed transaction can be executed concurrently.
+type TypedTransaction[T any] struct {
+	*Transaction
+}
+
+// DoneT gets the componentized `Transaction`, just like `Done`, that produces a result when it commits.
+// The result function is chained as the last action of the transaction, so it reads the MemoryCells
+// transactionally and the result is consistent with the rest of the transaction. It is executed in
+// every attempt, including the scan phase, the result of the attempt that commits is kept.
+// usage:
+// total := stm.DoneT(MySTM.NewT().Do(transfer), func(t *stm.Transaction) int {
+// 	return stm.ReadTVar(t, from) + stm.ReadTVar(t, to)
+// }, "Transfer")
+// sum, err := stm.ExecT(total)
+func DoneT[T any](tc *TransactionContext, result func(*Transaction) T, name ...string) *TypedTransaction[T] {
+	tt := new(TypedTransaction[T])
+	tc.DoErr(func(t *Transaction) error {
+		value := result(t)
+		if !t.IsScanning {
+			t.result = value
+		}
+		return nil
+	})
+	tt.Transaction = tc.Done(name...)
+	return tt
+}
+
+// ExecT executes the typed transaction, just like `Exec`, and returns its result once it has committed.
+// When the transaction fails with a non-retryable error, the error is returned along with the zero value.
+func ExecT[T any](tt *TypedTransaction[T]) (T, error) {
+	return ExecTContext(context.Background(), tt)
+}
+
+// ExecTContext executes the typed transaction, just like `ExecContext`, and returns its result once it
+// has committed. When the transaction is stopped, or fails with a non-retryable error, the error is
+// returned along with the zero value.
+// usage:
+// ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+// defer cancel()
+// sum, err := stm.ExecTContext(ctx, total)
+func ExecTContext[T any](ctx context.Context, tt *TypedTransaction[T]) (T, error) {
+	var zero T
+	execution := tt.execution()
+	if err := execution.run(ctx); err != nil {
+		return zero, err
+	}
+	return resultOf[T](execution), nil
+}
+
+// resultOf gets the result of the committed execution of a typed transaction.
+func resultOf[T any](execution *Transaction) T {
+	result, _ := execution.result.(T) // the result of type T can be a nil interface
+	return result
+}
+
+// Future is the result of a typed transaction executing asynchronously.
+// `fork`: The handle of the transaction executing on the forked thread, holding the result
+type Future[T any] struct {
+	fork *Fork
+}
+
+// ForkAndExecT forks from the calling thread and executes the typed transaction on the forked thread,
+// just like `ForkAndExec`. The returned Future is used for awaiting the result.
+// usage:
+// future := stm.ForkAndExecT(total)
+// ...
+// sum, err := future.Await()
+func ForkAndExecT[T any](tt *TypedTransaction[T]) *Future[T] {
+	return ForkAndExecTContext(context.Background(), tt)
+}
+
+// ForkAndExecTContext forks from the calling thread and executes the typed transaction on the forked thread,
+// just like `ForkAndExecContext`. The returned Future is used for awaiting the result.
+func ForkAndExecTContext[T any](ctx context.Context, tt *TypedTransaction[T]) *Future[T] {
+	future := new(Future[T])
+	future.fork = tt.stm.ForkAndExecContext(ctx, tt.Transaction)
+	return future
+}
+
+// Done gets a channel that is closed once the transaction has finished executing, for using in `select`.
+func (future *Future[T]) Done() <-chan struct{} {
+	return future.fork.Done()
+}
+
+// Status gets the current status of the transaction.
+func (future *Future[T]) Status() Status {
+	return future.fork.Statuses()[0]
+}
+
+// Cancel stops the transaction, when it is still executing. It is rolled back and stops retrying.
+func (future *Future[T]) Cancel() {
+	future.fork.Cancel()
+}
+
+// Await blocks until the transaction has finished executing, then returns its result, or the error it
+// failed with along with the zero value.
+func (future *Future[T]) Await() (T, error) {
+	var zero T
+	if err := future.fork.Wait(); err != nil {
+		return zero, err
+	}
+	return resultOf[T](future.fork.executions[0]), nil
+}
+
+// AwaitContext blocks, just like `Await`, until the transaction has finished executing or the context is
+// done. The transaction keeps executing when the context is done, in which case an error wrapping
+// `ErrCancelled` or `ErrTimedOut` is returned.
+func (future *Future[T]) AwaitContext(ctx context.Context) (T, error) {
+	select {
+	case <-future.fork.Done():
+		return future.Await()
+	case <-ctx.Done():
+		var zero T
+		return zero, contextError("future", ctx)
+	}
+}
@@ -0,0 +1,54 @@
+package stm
+
+import "testing"
+
+func TestTypedTransactions(t *testing.T) {
+	s := NewSTM()
+	tvar := NewTVar(s, 5)
+	double := DoneT(s.NewT().Do(func(tx *Transaction) bool {
+		return WriteTVar(tx, tvar, ReadTVar(tx, tvar)*2)
+	}), func(tx *Transaction) int {
+		return ReadTVar(tx, tvar) + 1
+	}, "double")
+	if value, err := ExecT(double); value != 11 || err != nil {
+		t.Fatalf("%d, %v", value, err)
+	}
+	if value, err := ForkAndExecT(double).Await(); value != 21 || err != nil {
+		t.Fatalf("%d, %v", value, err)
+	}
+	failing := DoneT(s.NewT().DoErr(func(*Transaction) error { return errPermanent }), func(*Transaction) string {
+		return "never"
+	})
+	if value, err := ExecT(failing); value != "" || err != errPermanent {
+		t.Fatalf("%q, %v", value, err)
+	}
+}
+
+func TestConcurrentFutures(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		tvar := NewTVar(s, 0)
+		increment := DoneT(s.NewT().Do(func(tx *Transaction) bool {
+			return WriteTVar(tx, tvar, ReadTVar(tx, tvar)+1)
+		}), func(tx *Transaction) int {
+			return ReadTVar(tx, tvar)
+		})
+		futures := make([]*Future[int], 20)
+		for i := range futures {
+			futures[i] = ForkAndExecT(increment)
+		}
+		// each execution has its own result, the value it committed
+		seen := make(map[int]bool, 0)
+		for _, future := range futures {
+			value, err := future.Await()
+			if err != nil || seen[value] {
+				t.Fatalf("%v: %d, %v", mode, value, err)
+			}
+			seen[value] = true
+		}
+		if increment.Stats().Commits != 20 || increment.GetVersion() == 0 {
+			t.Fatalf("%v: %d commits, version %d", mode, increment.Stats().Commits, increment.GetVersion())
+		}
+	}
+}
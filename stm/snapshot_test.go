@@ -0,0 +1,145 @@
+package stm
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// historyOf gets the number of older versions the MemoryCell of the TVar keeps.
+func historyOf[T any](tvar *TVar[T]) int {
+	tvar.cell.mutex.RLock()
+	defer tvar.cell.mutex.RUnlock()
+	return len(tvar.cell.history)
+}
+
+func TestSnapshotHistoryIsBounded(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		tvar := NewTVar(s, 0)
+		opened, release := make(chan struct{}), make(chan struct{})
+		var first, second int
+		blocked := false
+		reader := s.NewReadOnlyT().Do(func(tx *Transaction) bool {
+			first = ReadTVar(tx, tvar)
+			if !blocked {
+				blocked = true
+				close(opened)
+				<-release
+			}
+			second = ReadTVar(tx, tvar)
+			return true
+		}).Done()
+		done := make(chan error)
+		go func() { done <- s.Exec(reader) }()
+		<-opened
+		increment := s.NewT().Do(func(tx *Transaction) bool {
+			return WriteTVar(tx, tvar, ReadTVar(tx, tvar)+1)
+		}).Done()
+		for range 100 {
+			if err := s.Exec(increment); err != nil {
+				t.Fatal(err)
+			}
+			// only the version read by the open snapshot is kept
+			if n := historyOf(tvar); n > 1 {
+				t.Fatalf("%v: %d versions kept for a single snapshot", mode, n)
+			}
+		}
+		close(release)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if first != 0 || second != 0 {
+			t.Fatalf("%v: the snapshot read %d then %d", mode, first, second)
+		}
+		// closing the snapshot garbage collects the versions without waiting for the next write
+		if n := historyOf(tvar); n != 0 {
+			t.Fatalf("%v: %d versions kept after the snapshot was closed", mode, n)
+		}
+	}
+}
+
+func TestNoHistoryWithoutSnapshots(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		tvar := NewTVar(s, 0)
+		increment := s.NewT().Do(func(tx *Transaction) bool {
+			return WriteTVar(tx, tvar, ReadTVar(tx, tvar)+1)
+		}).Done()
+		for range 10 {
+			if err := s.Exec(increment); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := historyOf(tvar); n != 0 {
+			t.Fatalf("%v: %d versions kept with no snapshot open", mode, n)
+		}
+		s.snapshotsMutex.Lock()
+		tracked := len(s.histories)
+		s.snapshotsMutex.Unlock()
+		if tracked != 0 || s.openSnapshots.Load() != 0 {
+			t.Fatalf("%v: %d MemoryCells tracked, %d snapshots open", mode, tracked, s.openSnapshots.Load())
+		}
+	}
+}
+
+func TestReadOnlySnapshotIsConsistent(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		tvars := make([]*TVar[int], 50)
+		for i := range tvars {
+			tvars[i] = NewTVar(s, 10)
+		}
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				a, b := tvars[i%50], tvars[(i*7+3)%50]
+				if a == b {
+					continue
+				}
+				s.Exec(s.NewT().Do(func(tx *Transaction) bool {
+					return WriteTVar(tx, a, ReadTVar(tx, a)-1) && WriteTVar(tx, b, ReadTVar(tx, b)+1)
+				}).Done())
+			}
+		}()
+		sums := make([]int, 0)
+		report := s.NewReadOnlyT().Do(func(tx *Transaction) bool {
+			sum := 0
+			for _, tvar := range tvars {
+				sum += ReadTVar(tx, tvar)
+				time.Sleep(100 * time.Microsecond) // long enough for the transfers to commit in between
+			}
+			sums = append(sums, sum)
+			return true
+		}).Done()
+		for range 5 {
+			if err := s.Exec(report); err != nil {
+				t.Fatal(err)
+			}
+		}
+		close(stop)
+		<-stopped
+		// a snapshot never fails validation, each report executed once
+		if len(sums) != 5 {
+			t.Fatalf("%v: %d executions for 5 reports", mode, len(sums))
+		}
+		for _, sum := range sums {
+			if sum != 500 {
+				t.Fatalf("%v: the snapshot saw a total of %d", mode, sum)
+			}
+		}
+		write := s.NewReadOnlyT().Do(func(tx *Transaction) bool { return WriteTVar(tx, tvars[0], 1) }).Done()
+		if err := s.Exec(write); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("%v: %v", mode, err)
+		}
+	}
+}
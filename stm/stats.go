@@ -0,0 +1,279 @@
+/**
+* stats.go
+* @description Statistics of the transactions executed on the STM, with the reasons they aborted.
+ */
+
+package stm
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// AbortReason is the reason an attempt at executing a transaction was aborted.
+type AbortReason int
+
+const (
+	// AbortOwnershipConflict the transaction couldn't take the ownership of a writeSet member,
+	// when taking the ownerships or on a `WriteT`.
+	AbortOwnershipConflict AbortReason = iota
+	// AbortActionFailed an action returned false, or `ErrConflict`, when executing.
+	AbortActionFailed
+	// AbortReadValidation a readSet member was committed by another transaction before the commit.
+	AbortReadValidation
+	// AbortLostOwnership the ownership of a writeSet member was taken away before the commit.
+	AbortLostOwnership
+	// AbortInconsistentRead a MemoryCell committed after the transaction's snapshot was read.
+	AbortInconsistentRead
+	// AbortRetry an action called `Retry`, the transaction waited for its readSet to change.
+	AbortRetry
+	// AbortError an action failed with a non-retryable error, the transaction stopped executing.
+	AbortError
+	// AbortCancelled the context was done, the transaction stopped executing. It isn't counted as an attempt.
+	AbortCancelled
+	// abortReasons is the number of abort reasons.
+	abortReasons
+)
+
+// String gets the name of the abort reason.
+func (reason AbortReason) String() string {
+	switch reason {
+	case AbortOwnershipConflict:
+		return "ownership_conflict"
+	case AbortActionFailed:
+		return "action_failed"
+	case AbortReadValidation:
+		return "read_validation"
+	case AbortLostOwnership:
+		return "lost_ownership"
+	case AbortInconsistentRead:
+		return "inconsistent_read"
+	case AbortRetry:
+		return "retry"
+	case AbortError:
+		return "error"
+	case AbortCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// Phase is a phase of the execution of a transaction.
+type Phase int
+
+const (
+	// ScanPhase the actions are dry run to determine the readSet and writeSet.
+	ScanPhase Phase = iota
+	// OwnershipPhase the ownerships of the writeSet members are taken.
+	OwnershipPhase
+	// ExecutionPhase the actions are executed.
+	ExecutionPhase
+	// CommitPhase the writes are validated and made visible to the other transactions.
+	CommitPhase
+	// WaitPhase the transaction waits for its readSet to change after a `Retry`, or for a MemoryCell
+	// to be released after aborting to break a deadlock.
+	WaitPhase
+	// phases is the number of phases.
+	phases
+)
+
+// String gets the name of the phase.
+func (phase Phase) String() string {
+	switch phase {
+	case ScanPhase:
+		return "scan"
+	case OwnershipPhase:
+		return "ownership"
+	case ExecutionPhase:
+		return "execution"
+	case CommitPhase:
+		return "commit"
+	case WaitPhase:
+		return "wait"
+	}
+	return "unknown"
+}
+
+// Stats is a snapshot of the statistics of the transactions.
+// `Attempts`: The number of times the transactions started executing, including the retries
+// `Commits`: The number of times the transactions committed
+// `Aborts`: The number of aborted attempts, by reason, along with the cancellations
+// `PhaseTimes`: The total time spent in each phase, by all the attempts
+// `Retries`: The number of aborted attempts before each commit
+// `OwnershipHolds`: How long the ownerships of the MemoryCells were held for, in nanoseconds
+// `MemoryCells`: The number of MemoryCells in the STM, the transient ones excluded, only set for the STM's statistics
+// `OwnedCells`: The number of MemoryCells currently owned by transactions, only set for the STM's statistics
+type Stats struct {
+	Attempts       uint64
+	Commits        uint64
+	Aborts         map[AbortReason]uint64
+	PhaseTimes     map[Phase]time.Duration
+	Retries        Histogram
+	OwnershipHolds Histogram
+	MemoryCells    int
+	OwnedCells     int
+}
+
+// TotalAborts gets the number of aborted attempts, for any reason.
+func (stats Stats) TotalAborts() uint64 {
+	total := uint64(0)
+	for _, aborts := range stats.Aborts {
+		total += aborts
+	}
+	return total
+}
+
+// Histogram is a snapshot of the distribution of the values observed.
+// `Bounds`: The inclusive upper bounds of the buckets, in increasing order
+// `Counts`: The number of values observed in each bucket, it has one more bucket than `Bounds`
+// for the values greater than all the bounds
+// `Count`: The number of values observed
+// `Sum`: The sum of the values observed
+type Histogram struct {
+	Bounds []int64
+	Counts []uint64
+	Count  uint64
+	Sum    int64
+}
+
+// retryBounds are the bounds of the buckets of the `Retries` histogram.
+var retryBounds = [...]int64{0, 1, 2, 4, 8, 16, 32, 64, 128}
+
+// holdBounds are the bounds of the buckets of the `OwnershipHolds` histogram.
+var holdBounds = [...]int64{
+	int64(time.Microsecond), int64(10 * time.Microsecond), int64(100 * time.Microsecond),
+	int64(time.Millisecond), int64(10 * time.Millisecond), int64(100 * time.Millisecond),
+	int64(time.Second), int64(10 * time.Second),
+}
+
+// stats holds the counters of the transactions. They are updated concurrently, hence atomic.
+type stats struct {
+	attempts   atomic.Uint64
+	commits    atomic.Uint64
+	aborts     [abortReasons]atomic.Uint64
+	phaseTimes [phases]atomic.Int64
+	retries    [len(retryBounds) + 1]atomic.Uint64
+	retriesSum atomic.Int64
+	holds      [len(holdBounds) + 1]atomic.Uint64
+	holdsSum   atomic.Int64
+}
+
+// observe adds the value to the histogram made of the buckets `counts` and their `sum`.
+func observe(counts []atomic.Uint64, sum *atomic.Int64, bounds []int64, value int64) {
+	bucket, _ := slices.BinarySearch(bounds, value)
+	counts[bucket].Add(1)
+	sum.Add(value)
+}
+
+// histogramOf takes a snapshot of the histogram made of the buckets `counts` and their `sum`.
+func histogramOf(counts []atomic.Uint64, sum *atomic.Int64, bounds []int64) Histogram {
+	snapshot := Histogram{Bounds: slices.Clone(bounds), Counts: make([]uint64, len(counts))}
+	for i := range counts {
+		snapshot.Counts[i] = counts[i].Load()
+		snapshot.Count += snapshot.Counts[i]
+	}
+	snapshot.Sum = sum.Load()
+	return snapshot
+}
+
+// snapshot takes a snapshot of the counters.
+func (counters *stats) snapshot() Stats {
+	snapshot := Stats{
+		Attempts:       counters.attempts.Load(),
+		Commits:        counters.commits.Load(),
+		Aborts:         make(map[AbortReason]uint64, abortReasons),
+		PhaseTimes:     make(map[Phase]time.Duration, phases),
+		Retries:        histogramOf(counters.retries[:], &counters.retriesSum, retryBounds[:]),
+		OwnershipHolds: histogramOf(counters.holds[:], &counters.holdsSum, holdBounds[:]),
+	}
+	for reason := range abortReasons {
+		snapshot.Aborts[reason] = counters.aborts[reason].Load()
+	}
+	for phase := range phases {
+		snapshot.PhaseTimes[phase] = time.Duration(counters.phaseTimes[phase].Load())
+	}
+	return snapshot
+}
+
+// Stats gets a snapshot of the statistics of all the transactions executed on the STM.
+// usage:
+// stats := MySTM.Stats()
+// log.Println(stats.Commits, stats.Aborts[stm.AbortReadValidation])
+func (stm *STM) Stats() Stats {
+	snapshot := stm.stats.snapshot()
+	stm.stmMutex.Lock()
+	memory := slices.Clone(stm._Memory)
+	stm.stmMutex.Unlock()
+	snapshot.MemoryCells = len(memory)
+	for _, memcell := range memory {
+		if memcell.owner.Load() != nil {
+			snapshot.OwnedCells++
+		}
+	}
+	return snapshot
+}
+
+// Stats gets a snapshot of the statistics of the transaction, over all of its executions.
+func (t *Transaction) Stats() Stats {
+	return t.stats.snapshot()
+}
+
+// countAttempt counts a new attempt at executing the `Transaction t`.
+func (t *Transaction) countAttempt() {
+	t.stats.attempts.Add(1)
+	t.stm.stats.attempts.Add(1)
+}
+
+// countCommit counts a successful commit of the `Transaction t`, after `retries` aborted attempts.
+func (t *Transaction) countCommit(retries int64) {
+	t.stats.commits.Add(1)
+	t.stm.stats.commits.Add(1)
+	observe(t.stats.retries[:], &t.stats.retriesSum, retryBounds[:], retries)
+	observe(t.stm.stats.retries[:], &t.stm.stats.retriesSum, retryBounds[:], retries)
+}
+
+// countAbort counts an aborted attempt at executing the `Transaction t`.
+func (t *Transaction) countAbort(reason AbortReason) {
+	t.log(slog.LevelDebug, "aborted", "reason", reason.String())
+	t.stats.aborts[reason].Add(1)
+	t.stm.stats.aborts[reason].Add(1)
+}
+
+// countHold counts the time the `Transaction t` held the ownership of a MemoryCell for.
+func (t *Transaction) countHold(held time.Duration) {
+	observe(t.stats.holds[:], &t.stats.holdsSum, holdBounds[:], int64(held))
+	observe(t.stm.stats.holds[:], &t.stm.stats.holdsSum, holdBounds[:], int64(held))
+}
+
+// enterPhase moves the `Transaction t` into the phase. The function returned adds the time elapsed
+// since to the time the transaction spent in the phase.
+// usage:
+// defer t.enterPhase(ExecutionPhase)()
+func (t *Transaction) enterPhase(phase Phase) func() {
+	t.metadata.phase = phase
+	start := time.Now()
+	return func() {
+		elapsed := int64(time.Since(start))
+		t.stats.phaseTimes[phase].Add(elapsed)
+		t.stm.stats.phaseTimes[phase].Add(elapsed)
+	}
+}
+
+// abortReasonOf gets the reason for aborting an execution that failed with the error.
+func (t *Transaction) abortReasonOf(err error) AbortReason {
+	switch {
+	case t.metadata.retry || errors.Is(err, ErrRetry):
+		return AbortRetry
+	case errors.Is(err, errInconsistentRead):
+		return AbortInconsistentRead
+	case t.metadata.conflicted && errors.Is(err, ErrConflict):
+		// the action most probably failed because a WriteT couldn't take the ownership
+		return AbortOwnershipConflict
+	case errors.Is(err, ErrConflict):
+		return AbortActionFailed
+	}
+	return AbortError
+}
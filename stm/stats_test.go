@@ -0,0 +1,39 @@
+package stm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		tvar := NewTVar(s, 0)
+		ts := make([]*Transaction, 50)
+		for i := range ts {
+			ts[i] = s.NewT().Do(func(tx *Transaction) bool {
+				value := ReadTVar(tx, tvar)
+				time.Sleep(10 * time.Microsecond)
+				return WriteTVar(tx, tvar, value+1)
+			}).Done()
+		}
+		if err := s.Exec(ts...); err != nil {
+			t.Fatal(err)
+		}
+		stats := s.Stats()
+		if stats.Commits != 50 || stats.Attempts != stats.Commits+stats.TotalAborts() {
+			t.Fatalf("%v: %+v", mode, stats)
+		}
+		if stats.MemoryCells != 1 || stats.OwnedCells != 0 {
+			t.Fatalf("%v: %d MemoryCells, %d owned", mode, stats.MemoryCells, stats.OwnedCells)
+		}
+		if ts[0].Stats().Commits != 1 {
+			t.Fatalf("%v: the transaction counted %d commits", mode, ts[0].Stats().Commits)
+		}
+		failing := s.NewT().DoErr(func(tx *Transaction) error { return errPermanent }).Done()
+		if err := s.Exec(failing); err != errPermanent || failing.Stats().Aborts[AbortError] != 1 {
+			t.Fatalf("%v: %v, %+v", mode, err, failing.Stats())
+		}
+	}
+}
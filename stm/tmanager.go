@@ -5,40 +5,105 @@
 memory in this framework.
 * @created Wed Nov 22 2017 21:59:44 GMT-0800 (PST)
 * @copyright 2017 Sidharth Mishra
-* @last-modified Wed Nov 22 2017 23:56:05 GMT-0800 (PST)
+* @last-modified Fri Oct 16 2026 10:37:40 GMT+0000 (UTC)
 */
 
 package stm
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // STM represents the STM (Software Transactional Memory). It is the only piece of
 // shared memory in the framework.
+// `stmMutex`: Guards the `_Memory` vector and the wait-for graph. The MemoryCells have their own locks,
+// so that the transactions touching different MemoryCells never contend
 // `_Memory`: It's the vector that holds the `MemoryCell`s.
-// `_Ownerships`: It's the vector that holds the MemoryCell's ownerships
+// `cells`: The number of MemoryCells made on the STM, the transient ones included, numbering them
+// `waiters`: The registry of transactions waiting in `Retry` for MemoryCells to be committed
+// `lockingMode`: Decides when the transactions take ownership of the MemoryCells they write to
+// `versionClock`: The global version clock, incremented by every commit that writes to MemoryCells
+// `snapshotsMutex`: Guards the registry of snapshots
+// `snapshots`: The versions of the active read only snapshots, along with the number of transactions reading each
+// `openSnapshots`: The number of transactions reading the snapshots, so that the commits skip the registry
+// and the histories altogether when there are none
+// `histories`: The MemoryCells holding older versions in their history, pruned when a snapshot is closed
+// `contentionManager`: Decides how the ownership conflicts between transactions are resolved
+// `waitForOwner`: When true, the ownership conflicts are resolved by waiting for the owner instead
+// `releases`: The registry of transactions waiting for the owners to release MemoryCells
+// `waitsFor`: The wait-for graph, the owner each waiting transaction is waiting for
+// `stats`: The statistics of all the transactions executed on the STM
+// `logger`: The logger of the STM and of the transactions executed on it
+// `observers`: The observers of the lifecycle of all the transactions executed on the STM
 type STM struct {
-	stmMutex    *sync.Mutex          // stm's mutex
-	_Memory     []*MemoryCell        // MemoryCells
-	_Ownerships map[int]*Transaction // *Ownership
+	stmMutex          *sync.Mutex                   // stm's mutex
+	_Memory           []*MemoryCell                 // MemoryCells
+	cells             atomic.Uint64                 // MemoryCells made
+	waiters           *waitRegistry                 // transactions blocked in Retry
+	lockingMode       LockingMode                   // when the ownerships are taken
+	versionClock      atomic.Uint64                 // commit timestamps
+	snapshotsMutex    sync.Mutex                    // snapshots' mutex
+	snapshots         map[uint64]int                // active snapshots
+	openSnapshots     atomic.Int64                  // transactions reading snapshots
+	histories         map[*MemoryCell]struct{}      // MemoryCells with versions kept for snapshots
+	contentionManager ContentionManager             // resolves ownership conflicts
+	waitForOwner      bool                          // wait for owners on conflicts
+	releases          *waitRegistry                 // transactions waiting for owners
+	waitsFor          map[*Transaction]*Transaction // wait-for graph
+	stats             stats                         // transactions' statistics
+	logger            *slog.Logger                  // logs through a pluggable handler
+	observers         []Observer                    // lifecycle observers
 }
 
+// LockingMode decides when the transactions take ownership of the MemoryCells they write to.
+type LockingMode int
+
+const (
+	// ScanLocking dry runs the actions in the `Scan` phase to determine the readSet and writeSet.
+	// The ownerships of the writeSet members are taken before executing the actions. This is the default.
+	ScanLocking LockingMode = iota
+	// EncounterTimeLocking doesn't scan, the actions are executed once per attempt. The ownership of a
+	// MemoryCell is taken on the first `WriteT` to it, a write fails when another transaction owns it.
+	EncounterTimeLocking
+	// CommitTimeLocking doesn't scan, the actions are executed once per attempt. The writes are buffered
+	// and the ownerships of the writeSet members are taken when committing.
+	CommitTimeLocking
+)
+
 // NewSTM creates a new STM instance. This acts as the single shared space.
 func NewSTM() *STM {
 	stm := new(STM)
 	stm.stmMutex = new(sync.Mutex)
 	stm._Memory = make([]*MemoryCell, 0)
-	stm._Ownerships = make(map[int]*Transaction, 0)
+	stm.waiters = newWaitRegistry()
+	stm.snapshots = make(map[uint64]int, 0)
+	stm.histories = make(map[*MemoryCell]struct{}, 0)
+	stm.contentionManager = NewPassiveManager()
+	stm.releases = newWaitRegistry()
+	stm.waitsFor = make(map[*Transaction]*Transaction, 0)
+	stm.logger = slog.Default()
 	return stm
 }
 
+// SetLockingMode sets the LockingMode used by the transactions executed on the STM.
+// The LockingMode must be set before executing any transactions.
+// usage:
+// MySTM.SetLockingMode(stm.EncounterTimeLocking)
+func (stm *STM) SetLockingMode(mode LockingMode) {
+	stm.lockingMode = mode
+}
+
 // MakeMemCell makes a new `MemoryCell` holding the data.
 func (stm *STM) MakeMemCell(data Data) *MemoryCell {
-	newMemCell := new(MemoryCell)
-	newMemCell.cellIndex = uint(len(stm._Memory))
-	newMemCell.writeData(data)
+	newMemCell := stm.MakeTransientMemCell(data)
 	//# add memory cell to STM - synchoronously
 	stm.stmMutex.Lock()
 	stm._Memory = append(stm._Memory, newMemCell)
@@ -47,6 +112,89 @@ func (stm *STM) MakeMemCell(data Data) *MemoryCell {
 	return newMemCell
 }
 
+// MakeTransientMemCell makes a new `MemoryCell` holding the data, without adding it to the `_Memory`
+// vector of the STM. It is garbage collected once nothing references it, instead of living as long as
+// the STM, so it suits the MemoryCells made inside the transactions, say, the links of linked data
+// structures. It is neither displayed by `Display` nor counted by `Stats`.
+func (stm *STM) MakeTransientMemCell(data Data) *MemoryCell {
+	newMemCell := new(MemoryCell)
+	newMemCell.writeData(data, 0)
+	newMemCell.cellIndex = uint(stm.cells.Add(1) - 1)
+	return newMemCell
+}
+
+// openSnapshot registers a new read only snapshot as of the current version of the clock.
+// The versions of the MemoryCells it can read are kept until it is closed.
+func (stm *STM) openSnapshot() uint64 {
+	stm.snapshotsMutex.Lock()
+	// counted before reading the clock, the commits that miss it have already incremented the clock
+	stm.openSnapshots.Add(1)
+	snapshot := stm.versionClock.Load()
+	stm.snapshots[snapshot]++
+	stm.snapshotsMutex.Unlock()
+	return snapshot
+}
+
+// closeSnapshot unregisters the read only snapshot. When it was the last transaction reading the
+// snapshot, the versions only it was reading are garbage collected right away.
+func (stm *STM) closeSnapshot(snapshot uint64) {
+	stm.snapshotsMutex.Lock()
+	stm.snapshots[snapshot]--
+	closed := stm.snapshots[snapshot] == 0
+	if closed {
+		delete(stm.snapshots, snapshot)
+	}
+	stm.openSnapshots.Add(-1)
+	stm.snapshotsMutex.Unlock()
+	if closed {
+		stm.pruneHistories()
+	}
+}
+
+// activeSnapshots gets the versions of the active snapshots, in increasing order.
+// Must be called after incrementing the clock for the commit, or while holding the lock of the MemoryCell
+// being pruned, so that the snapshots opened later never need the versions it garbage collects.
+func (stm *STM) activeSnapshots() []uint64 {
+	stm.snapshotsMutex.Lock()
+	defer stm.snapshotsMutex.Unlock()
+	return slices.Sorted(maps.Keys(stm.snapshots))
+}
+
+// trackHistory keeps track of the MemoryCell when it holds older versions in its history, so that they
+// are garbage collected when the snapshots reading them are closed.
+// Must be called while holding the MemoryCell's mutex for writing.
+func (stm *STM) trackHistory(memcell *MemoryCell) {
+	if len(memcell.history) == 0 {
+		return
+	}
+	stm.snapshotsMutex.Lock()
+	stm.histories[memcell] = struct{}{}
+	stm.snapshotsMutex.Unlock()
+}
+
+// pruneHistories garbage collects the versions none of the active snapshots read anymore, from all
+// the MemoryCells holding older versions.
+func (stm *STM) pruneHistories() {
+	stm.snapshotsMutex.Lock()
+	if len(stm.histories) == 0 {
+		stm.snapshotsMutex.Unlock()
+		return
+	}
+	memcells := slices.Collect(maps.Keys(stm.histories))
+	stm.snapshotsMutex.Unlock()
+	for _, memcell := range memcells {
+		memcell.mutex.Lock()
+		// the snapshots are read while holding the lock, the ones opened later read the latest version
+		memcell.prune(stm.activeSnapshots())
+		if len(memcell.history) == 0 {
+			stm.snapshotsMutex.Lock()
+			delete(stm.histories, memcell)
+			stm.snapshotsMutex.Unlock()
+		}
+		memcell.mutex.Unlock()
+	}
+}
+
 // Exec executes the transactions and holds the calling thread so that it doesn't exit prematurely.
 // This is just an utility method to make life easier for the consumer. The consumer can also use
 // Transaction's Go() to achieve this, but then the consumer has to pass their own sync.WaitGroup instance.
@@ -58,39 +206,78 @@ func (stm *STM) MakeMemCell(data Data) *MemoryCell {
 // 		wg.Wait()
 // > Note: Make sure that the STM instance executing the transaction is same as the one which was used to
 // construct it. Otherwise, it will result in an error since the shared memory won't be the same.
-func (stm *STM) Exec(ts ...*Transaction) {
+// Exec returns the first non-retryable error returned by the actions of the transactions, in the order
+// the transactions were passed. The transaction failing with it is not retried.
+func (stm *STM) Exec(ts ...*Transaction) error {
+	for _, err := range stm.ExecContext(context.Background(), ts...) {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExecContext executes the transactions just like `Exec`, but the transactions stop retrying as soon
+// as the context is cancelled or its deadline expires. It returns the outcome of each transaction, in
+// the order they were passed: `nil` when the transaction committed, an error wrapping `ErrCancelled`
+// or `ErrTimedOut` when it was stopped, else the non-retryable error returned by one of its actions.
+// usage:
+// ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+// defer cancel()
+// errs := MySTM.ExecContext(ctx, t1, t2)
+// timedOut := errors.Is(errs[0], stm.ErrTimedOut)
+func (stm *STM) ExecContext(ctx context.Context, ts ...*Transaction) []error {
+	errs := make([]error, len(ts))
 	wg := new(sync.WaitGroup)
-	for _, t := range ts {
+	for i, t := range ts {
 		wg.Add(1)
-		t.Go(wg)
+		t.GoContext(ctx, wg, &errs[i])
 	}
 	wg.Wait()
+	return errs
 }
 
 // Display displays the _Memory array of the STM
 func (stm *STM) Display() {
-	for i, memcell := range stm._Memory {
-		log.Println("memcell index = ", i, " memcell contents = ", memcell.data)
+	stm.stmMutex.Lock()
+	memory := slices.Clone(stm._Memory)
+	stm.stmMutex.Unlock()
+	ownerships := make(map[int]*Transaction, 0)
+	for i, memcell := range memory {
+		data, _ := memcell.readVersioned()
+		log.Println("memcell index = ", i, " memcell contents = ", data)
+		if owner := memcell.owner.Load(); owner != nil {
+			ownerships[i] = owner
+		}
 	}
-	log.Println("_Ownerships = ", stm._Ownerships)
+	log.Println("_Ownerships = ", ownerships)
 }
 
 // ForkAndExec forks from the calling thread and then executes all the transactions on the
 // forked thread. Basically it can be visualized as running the stm.Exec in another thread.
 // The consumer can simulate similar behavior by doing something like:
 // `go MySTM.Exec(ts...)`. This is a convinience method to keep it uniform.
-func (stm *STM) ForkAndExec(ts ...*Transaction) {
-	go func(ts ...*Transaction) {
-		wg := new(sync.WaitGroup)
-		for _, t := range ts {
-			wg.Add(1)
-			t.Go(wg)
-		}
-		wg.Wait()
-	}(ts...)
+// The returned `Fork` is used for waiting for the transactions, cancelling them and checking their status.
+// usage:
+// fork := MySTM.ForkAndExec(t1, t2)
+// ...
+// err := fork.Wait()
+func (stm *STM) ForkAndExec(ts ...*Transaction) *Fork {
+	return stm.ForkAndExecContext(context.Background(), ts...)
+}
+
+// SetLogHandler sets the handler of the STM's logger, used by `Log` and by the transactions executed on
+// the STM. By default, the STM logs through `slog.Default()`, writing `slog.LevelInfo` and above to stderr.
+// The transactions trace their progress at `slog.LevelDebug`, with the attributes `transaction`, `attempt`,
+// `phase` and, when it is about a MemoryCell, `cell`, so they are silent until a handler enabling it is set.
+// The handler must be set before executing any transactions.
+// usage:
+// MySTM.SetLogHandler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+func (stm *STM) SetLogHandler(handler slog.Handler) {
+	stm.logger = slog.New(handler)
 }
 
-// Log logs the messages synchronously
+// Log logs the messages synchronously, at `slog.LevelInfo`, through the STM's logger.
 func (stm *STM) Log(msgs ...interface{}) {
-	log.Println(msgs...)
+	stm.logger.Info(strings.TrimSuffix(fmt.Sprintln(msgs...), "\n"))
 }
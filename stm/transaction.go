@@ -4,53 +4,90 @@
 * @description Contains definitions of the `Record` object.
 * @created Wed Nov 22 2017 21:59:31 GMT-0800 (PST)
 * @copyright 2017 Sidharth Mishra
-* @last-modified Thu Nov 23 2017 18:08:05 GMT-0800 (PST)
+* @last-modified Fri Oct 16 2026 10:37:40 GMT+0000 (UTC)
  */
 
 package stm
 
 import (
-	"log"
-	"reflect"
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-//# For Debugging
-
-// use the flag to denote that all logs in transactions should be printed to stdout/stderr
-const debugFlag bool = false
-
-//# For Debugging
-
 // Record represents a record that contains the metadata for a transaction.
 // * `status` - the status of the transaction, true if it has successfully completed, else false
-// * `version` - the version of the transaction, initially starts at 0, its incremented after every termination
+// * `version` - the version of the transaction, initially starts at 0, it is the commit timestamp of its latest successful execution
 // * `oldValues` - the vector containing the old values of the memory cells when they are updated in the transaction.
+// * `readVersions` - the versions of the memory cells when they were first read in the transaction, used for validating the commit.
 // * `readSet` - the set of MemoryCell indices - addresses - of the memory cells that the transaction intends to read from.
 // * `writeSet` - the set of MemoryCell indices - addresses - of the memory cells that the transaction intends to write to or update.
+// * `retry` - true when an action has called `Retry` in the current execution of the transaction.
+// * `startVersion` - the version of the STM's clock when the current execution started, the snapshot the transaction reads from.
+// * `blocker` - the MemoryCell whose owner the transaction couldn't wait for without deadlocking, waited for before restarting.
+// * `conflicted` - true when a `WriteT` has failed to take the ownership in the current execution of the transaction.
+// * `attempt` - the number of the current attempt at executing the transaction, starting at 1.
+// * `phase` - the phase the current attempt is in.
+// * `commutes` - the commutative updates of the memory cells, applied to their latest data when committing.
 type Record struct {
-	name      string
-	status    bool
-	version   int
-	oldValues map[*MemoryCell]Data
-	readSet   []*MemoryCell
-	writeSet  []*MemoryCell
+	name         string
+	status       bool
+	version      uint64
+	oldValues    map[*MemoryCell]Data
+	readVersions map[*MemoryCell]uint64
+	readSet      []*MemoryCell
+	writeSet     []*MemoryCell
+	retry        bool
+	startVersion uint64
+	blocker      *MemoryCell
+	conflicted   bool
+	attempt      int
+	phase        Phase
+	commutes     map[*MemoryCell][]func(Data) Data
 }
 
 // Transaction the transaction, as a component. This can be passed around. It has its own context.
 // It will carry out the actions mentioned while constructing it and will always be consistent.
+// The Transaction returned by `Done` is a template, it is never executed itself. Each `Go` or `Exec`
+// executes a fresh copy of it, with its own metadata and transactional variables, so the same Transaction
+// can be executed by many threads/goroutines at once, say, `MySTM.Exec(t1, t1)`.
 type Transaction struct {
 	metadata   Record
-	actions    []func() bool
+	actions    []func(*Transaction) error
 	stm        *STM
 	IsScanning bool            // true value indicates that the transaction is in Scan mode
 	tvars      map[string]Data // map of all the transactional variables
+	readOnly   bool            // true value indicates that the transaction reads from a snapshot
+	contention contention      // used by the ContentionManager for resolving conflicts
+	stats      *stats          // statistics of all the executions of the transaction, shared by them
+	hooks      hooks           // lifecycle hooks registered on the transaction context
+	template   *Transaction    // the transaction this is an execution of, nil for the templates
+	latest     atomic.Uint64   // the commit timestamp of the latest successful execution, kept by the templates
+	result     any             // the result of the execution of a typed transaction
+	ctx        context.Context // the context the execution is run with, nil for the templates
+}
+
+// contention holds the details of the transaction used by the `ContentionManager`s.
+// They are read by the other transactions, hence atomic.
+// `startTime`: When the transaction started executing, in nanoseconds, retries don't reset it
+// `karma`: The number of MemoryCells opened by the transaction since it started executing
+// `waiting`: true when the transaction is waiting on a conflict
+type contention struct {
+	startTime atomic.Int64
+	karma     atomic.Int64
+	waiting   atomic.Bool
 }
 
 // TransactionContext a transaction context - just like Monads - inspired by Monads.
 // This defines a context within which the STM operations will be available.
 type TransactionContext struct {
-	actions     []func() bool
+	actions     []func(*Transaction) error
 	transaction *Transaction
 }
 
@@ -58,9 +95,21 @@ type TransactionContext struct {
 func (stm *STM) NewT() *TransactionContext {
 	tc := new(TransactionContext)
 	tc.transaction = new(Transaction)
-	tc.actions = make([]func() bool, 0)
+	tc.actions = make([]func(*Transaction) error, 0)
 	tc.transaction.stm = stm
 	tc.transaction.tvars = make(map[string]Data, 0)
+	tc.transaction.stats = new(stats)
+	return tc
+}
+
+// NewReadOnlyT makes a new read only transaction context.
+// A read only transaction reads a consistent snapshot of the MemoryCells, as of the time its execution
+// started. It never takes ownerships and never fails validation, no matter how many transactions commit
+// while it is executing, which makes it suitable for long running reports. It is never scanned.
+// Writing to a MemoryCell inside a read only transaction fails it with `ErrReadOnly`.
+func (stm *STM) NewReadOnlyT() *TransactionContext {
+	tc := stm.NewT()
+	tc.transaction.readOnly = true
 	return tc
 }
 
@@ -68,8 +117,58 @@ func (stm *STM) NewT() *TransactionContext {
 // Each action is wrapped inside an anonymous lambda. This method will add a wrapper and pass the
 // `Transaction` so that the action is within the desired Transaction's context.
 // In DB terms, this will represent an `Action`. A transaction comprises of multiple `Actions`.
+// When the action returns false, the transaction is rolled back and retried, the same as
+// returning `ErrConflict` from an action chained using `DoErr`.
 func (tc *TransactionContext) Do(lambda func(*Transaction) bool) *TransactionContext {
-	tc.actions = append(tc.actions, func() bool { return lambda(tc.transaction) })
+	tc.actions = append(tc.actions, func(t *Transaction) error {
+		if !lambda(t) {
+			return ErrConflict
+		}
+		return nil
+	})
+	return tc
+}
+
+// DoErr is used to chain actions that report failures as errors together in the transaction.
+// When the action returns an error wrapping `ErrConflict`, the transaction is rolled back and retried.
+// Any other error is treated as permanent, the transaction is rolled back and stops executing, the
+// error is reported to the caller of `Exec`.
+// usage:
+// MySTM.NewT().
+// 	DoErr(func(t *stm.Transaction) error {
+// 		balance := stm.ReadTVar(t, account)
+// 		if balance < 100 {
+// 			return ErrInsufficientFunds // aborts for good
+// 		}
+// 		if !stm.WriteTVar(t, account, balance-100) {
+// 			return stm.ErrConflict // rolls back and retries
+// 		}
+// 		return nil
+// 	}).
+// 	Done()
+func (tc *TransactionContext) DoErr(lambda func(*Transaction) error) *TransactionContext {
+	tc.actions = append(tc.actions, lambda)
+	return tc
+}
+
+// OrElse is used to chain alternative actions together in the transaction. When executing, the
+// alternatives are tried one after the other, until one of them succeeds. An alternative that calls
+// `Retry` has its tentative writes discarded before the next one is tried. Any other error, including
+// `ErrConflict`, fails the whole action, so a conflict restarts the transaction from the first alternative.
+// When all the alternatives retry, the transaction waits for a change in the MemoryCells read by any of them.
+// All the alternatives take part in the same transaction, so whichever succeeds is committed atomically
+// with the rest of the transaction's actions.
+// > Note: In the scan phase, all the alternatives are scanned, so the transaction takes ownership of the
+// MemoryCells written by any of them.
+// usage:
+// MySTM.NewT().
+// 	OrElse(
+// 		func(t *stm.Transaction) error { return takeFrom(t, queueA) },
+// 		func(t *stm.Transaction) error { return takeFrom(t, queueB) },
+// 	).
+// 	Done()
+func (tc *TransactionContext) OrElse(alternatives ...func(*Transaction) error) *TransactionContext {
+	tc.actions = append(tc.actions, func(t *Transaction) error { return t.orElse(alternatives) })
 	return tc
 }
 
@@ -92,21 +191,57 @@ func (tc *TransactionContext) Done(name ...string) *Transaction {
 		tName = name[0]
 	}
 	tc.transaction.metadata = Record{
-		name:      tName,
-		status:    false,
-		version:   0,
-		oldValues: make(map[*MemoryCell]Data, 0),
-		readSet:   make([]*MemoryCell, 0),
-		writeSet:  make([]*MemoryCell, 0),
+		name:         tName,
+		status:       false,
+		version:      0,
+		oldValues:    make(map[*MemoryCell]Data, 0),
+		readVersions: make(map[*MemoryCell]uint64, 0),
+		commutes:     make(map[*MemoryCell][]func(Data) Data, 0),
+		readSet:      make([]*MemoryCell, 0),
+		writeSet:     make([]*MemoryCell, 0),
 	}
 	tc.transaction.actions = tc.actions
 	tc.transaction.IsScanning = true // default is true
 	return tc.transaction
 }
 
+// execution makes a fresh execution of the `Transaction t`, the template. The execution shares the
+// actions, the hooks and the statistics of the template, but has its own metadata, transactional
+// variables and contention details, so that the concurrent executions of the same template never
+// interfere with each other.
+func (t *Transaction) execution() *Transaction {
+	execution := new(Transaction)
+	execution.metadata = Record{
+		name:         t.metadata.name,
+		oldValues:    make(map[*MemoryCell]Data, 0),
+		readVersions: make(map[*MemoryCell]uint64, 0),
+		commutes:     make(map[*MemoryCell][]func(Data) Data, 0),
+		readSet:      make([]*MemoryCell, 0),
+		writeSet:     make([]*MemoryCell, 0),
+	}
+	execution.actions = t.actions
+	execution.stm = t.stm
+	execution.IsScanning = true
+	execution.tvars = make(map[string]Data, len(t.tvars))
+	for name, value := range t.tvars {
+		// the values are cloned, so that the changes made by an execution are not seen by the others
+		if value != nil {
+			value = value.Clone()
+		}
+		execution.tvars[name] = value
+	}
+	execution.readOnly = t.readOnly
+	execution.stats = t.stats
+	execution.hooks = t.hooks
+	execution.template = t
+	return execution
+}
+
 //# Transactional Variables
 
 // GetTVar gets the value of the Transactional Variable for the name provided.
+// Each execution starts with clones of the values added using `Where`, the values put, or changed, by
+// the other executions are not seen.
 // Note: It will return `nil` when the transaction is in its `Scan Phase`. Make sure to
 // check for `nil` values.
 // Usage:
@@ -137,12 +272,36 @@ func (t *Transaction) PutTVar(name string, value Data) {
 
 // ReadT a transactional read operation. Reads the data from the passed MemoryCell instance.
 // When reading a MemoryCell, the trasaction doesn't need to take ownership.
+// Reading a MemoryCell the transaction has already written to returns the data written.
+// The data read is always consistent with the data read before in the same execution. When the
+// MemoryCell has been committed by another transaction since, making the snapshot stale, the
+// execution is aborted right away, unwinding the actions, and the transaction restarts.
+// > Note: Don't `recover` from panics inside the actions without re-panicking, it would swallow the abort.
 func (t *Transaction) ReadT(memcell *MemoryCell) Data {
+	//# read own writes
+	if newData, written := t.metadata.oldValues[memcell]; written {
+		return newData.Clone()
+	}
+	//# read own writes
+	if t.readOnly {
+		return t.readSnapshot(memcell)
+	}
+	t.contention.karma.Add(1)
 	//# read data from stm
-	t.stm.stmMutex.Lock()
-	data := t.stm._Memory[memcell.cellIndex].readData()
-	t.stm.stmMutex.Unlock()
+	data, version := memcell.readVersioned()
+	// after extending the snapshot, the data read must still be the data as of the new snapshot
+	consistent := version <= t.metadata.startVersion || (t.extendSnapshot() && memcell.currentVersion() == version)
+	if !consistent {
+		t.log(slog.LevelDebug, "read a cell committed after the snapshot, aborting", cellAttr(memcell), "version", version)
+		t.abort(errInconsistentRead)
+	}
 	//# read data from stm
+	//# record the version
+	// the version first read is validated when committing, and by the snapshot extensions
+	if _, read := t.metadata.readVersions[memcell]; !read {
+		t.metadata.readVersions[memcell] = version
+	}
+	//# record the version
 	//# Adding to read set
 	// If the address of the memory cell is not in the writeset
 	// then, add it into the ReadSet, else do nothing
@@ -150,15 +309,33 @@ func (t *Transaction) ReadT(memcell *MemoryCell) Data {
 		if !contains(t.metadata.writeSet, memcell) && !contains(t.metadata.readSet, memcell) {
 			t.metadata.readSet = append(t.metadata.readSet, memcell)
 		}
-		t.log(t.metadata.name, " Scanning, added ", memcell, " to readSet", t.metadata.readSet)
-		t.log(t.metadata.name, " and got data = ", data)
+		t.log(slog.LevelDebug, "added the cell to the readSet", cellAttr(memcell), "data", data)
 		return data // early return, no need to take backup during scan phase
 	}
+	// the actions may read MemoryCells they didn't read in the scan phase
+	if !contains(t.metadata.readSet, memcell) {
+		t.metadata.readSet = append(t.metadata.readSet, memcell)
+	}
 	//# Adding to read set
-	//# backup
-	// take backup into the oldValues
-	t.metadata.oldValues[memcell] = data
-	//# backup
+	//# read own commutative updates
+	for _, update := range t.metadata.commutes[memcell] {
+		data = update(data)
+	}
+	//# read own commutative updates
+	return data
+}
+
+// readSnapshot a transactional read operation for the read only transactions. Reads the data from the
+// passed MemoryCell instance as of the transaction's snapshot.
+func (t *Transaction) readSnapshot(memcell *MemoryCell) Data {
+	data, version := memcell.readSnapshot(t.metadata.startVersion)
+	//# record the version, used by Retry
+	// the readVersions are looked up instead of the readSet, the reports read thousands of MemoryCells
+	if _, read := t.metadata.readVersions[memcell]; !read {
+		t.metadata.readVersions[memcell] = version
+		t.metadata.readSet = append(t.metadata.readSet, memcell)
+	}
+	//# record the version, used by Retry
 	return data
 }
 
@@ -166,7 +343,13 @@ func (t *Transaction) ReadT(memcell *MemoryCell) Data {
 // When intending to write to a MemoryCell, a transaction must take ownership of the MemoryCell.
 // If the transaction failed to take ownership of the MemoryCell, write fails. Returns true when the data
 // is successfully written into the MemoryCell.
+// Depending on the STM's `LockingMode`, the ownership is taken before executing the actions, on the
+// first write to the MemoryCell, or when committing.
 func (t *Transaction) WriteT(memcell *MemoryCell, data Data) (succeeded bool) {
+	if t.readOnly {
+		t.log(slog.LevelDebug, "read only, can't write", cellAttr(memcell))
+		t.abort(ErrReadOnly)
+	}
 	//# Adding to write set
 	if t.IsScanning {
 		// if contains(t.metadata.readSet, memcell) {
@@ -175,239 +358,744 @@ func (t *Transaction) WriteT(memcell *MemoryCell, data Data) (succeeded bool) {
 		if !contains(t.metadata.writeSet, memcell) {
 			t.metadata.writeSet = append(t.metadata.writeSet, memcell)
 		}
-		t.log(t.metadata.name, " Scanning, added ", memcell, " to writeSet", t.metadata.writeSet)
-		t.log(t.metadata.name, " readSet = ", t.metadata.readSet)
+		t.metadata.oldValues[memcell] = data // so that the scanned actions read their own writes
+		t.log(slog.LevelDebug, "added the cell to the writeSet", cellAttr(memcell))
 		return true // no need to write the contents into the memorycell during scan phase
 	}
 	//# Adding to write set
 	//# Check ownership of the memCell and write to oldValues
-	t.stm.stmMutex.Lock()
-	owner := t.stm._Ownerships[int(memcell.cellIndex)]
-	t.stm.stmMutex.Unlock()
+	t.contention.karma.Add(1)
+	owner := memcell.owner.Load()
+	if t.stm.lockingMode == EncounterTimeLocking && owner == nil {
+		// first encounter with the MemoryCell, take ownership before writing
+		owner = memcell.tryOwn(t)
+		t.log(slog.LevelDebug, "tried to take ownership", cellAttr(memcell), "taken", owner == t)
+	}
+	if t.stm.lockingMode == EncounterTimeLocking && owner != t && !contains(t.metadata.writeSet, memcell) {
+		// first encounter with the MemoryCell, but it is owned by another transaction
+		// when it was already in the writeSet, the ownership was taken away, so fail
+		if t.resolveConflict(t.ctx, memcell, owner) {
+			owner = t
+		}
+	}
+	if t.stm.lockingMode == CommitTimeLocking {
+		owner = t // the ownership is taken when committing
+	}
 	if owner == t {
+		if !contains(t.metadata.writeSet, memcell) {
+			t.metadata.writeSet = append(t.metadata.writeSet, memcell)
+		}
 		// already the owner of the MemoryCell so no need to take ownership again
 		// proceed with the Write operation.
 		//# newData is stored in oldValues
 		t.metadata.oldValues[memcell] = data
+		delete(t.metadata.commutes, memcell) // the write supersedes the commutative updates
 		//# newData is stored in oldValues
 		succeeded = true
-		t.log(t.metadata.name, "  already has ownership of ", memcell, " hence write was successful")
+		t.log(slog.LevelDebug, "has ownership, write was successful", cellAttr(memcell))
 	} else {
 		succeeded = false
-		t.log(t.metadata.name, "  couldn't take ownership of ", memcell, " write operation has failed.")
+		t.metadata.conflicted = true
+		t.log(slog.LevelDebug, "couldn't take ownership, write has failed", cellAttr(memcell))
 	}
 	//# Check ownership of the memCell and write to oldValues
 	return succeeded
 }
 
+// CommuteT a transactional commutative update operation. Updates the data of the MemoryCell using the
+// function, which must commute with the other updates of the MemoryCell, say, adding to a counter.
+// The update is deferred till the commit, where it is applied to the latest data of the MemoryCell. So the
+// transaction neither reads the MemoryCell nor takes its ownership, and the transactions updating the same
+// MemoryCell commutatively never conflict with each other.
+// Reading the MemoryCell afterwards, in the same transaction, reads it as usual and applies the updates to
+// the data read. Writing to it discards the updates, the write supersedes them.
+// > Note: The update is passed a copy of the data, it may be called more than once.
+// usage:
+// t.CommuteT(hits, func(data stm.Data) stm.Data {
+// 	return data.(Count) + 1
+// })
+func (t *Transaction) CommuteT(memcell *MemoryCell, update func(Data) Data) {
+	if t.readOnly {
+		t.log(slog.LevelDebug, "read only, can't update", cellAttr(memcell))
+		t.abort(ErrReadOnly)
+	}
+	if t.IsScanning {
+		return // no ownership to take, so nothing to add to the writeSet
+	}
+	t.contention.karma.Add(1)
+	if newData, written := t.metadata.oldValues[memcell]; written {
+		// already written, hence owned, so update the data written right away
+		t.metadata.oldValues[memcell] = update(newData.Clone())
+		return
+	}
+	t.metadata.commutes[memcell] = append(t.metadata.commutes[memcell], update)
+	t.log(slog.LevelDebug, "deferred the commutative update", cellAttr(memcell))
+}
+
 // Go starts executing the `Transaction t`.
 // Keeps looping infinitely, retrying the actions of the transaction until it executes successfully.
+// Each call starts a new execution, so the same transaction can be started many times concurrently.
 func (t *Transaction) Go(wg *sync.WaitGroup) {
+	t.GoContext(context.Background(), wg, nil)
+}
+
+// GoContext starts executing the `Transaction t` just like `Go`, but it stops retrying as soon as
+// the context is done. In that case, the transaction is rolled back, releasing all its ownerships.
+// The outcome is stored into `err`, when it is not nil, before signalling the wait group:
+// `nil` when the transaction committed, an error wrapping `ErrCancelled` or `ErrTimedOut` when it
+// was stopped, else the non-retryable error returned by one of its actions.
+// usage:
+// var err error
+// wg.Add(1)
+// t1.GoContext(ctx, wg, &err)
+// wg.Wait()
+func (t *Transaction) GoContext(ctx context.Context, wg *sync.WaitGroup, err *error) {
 	//# spawn and execute in new thread/goroutine
+	execution := t.execution()
 	go func() {
-		//# Transaction's execution loop, keeps retrying till it successfully executes
-		for {
-			//# Scanning phase
-			t.metadata.status = false // signal that t transaction has started execution
-			t.log(t.metadata.name, "has started scanning")
-			t.scanActions() // scan the actions to determine readSet and writeSet
-			t.log(t.metadata.name, "has finished scanning")
+		status := execution.run(ctx)
+		if err != nil {
+			*err = status
+		}
+		wg.Done()
+	}()
+	//# spawn and execute in new thread/goroutine
+}
+
+// run executes the `Transaction t`, an execution of a template, on the calling thread/goroutine.
+// It keeps retrying the actions of the transaction until it executes successfully, an action fails
+// with a non-retryable error or the context is done.
+func (t *Transaction) run(ctx context.Context) error {
+	t.ctx = ctx
+	if t.readOnly {
+		return t.runSnapshot(ctx)
+	}
+	t.contention.startTime.Store(time.Now().UnixNano())
+	t.contention.karma.Store(0)
+	t.metadata.attempt = 0
+	//# Transaction's execution loop, keeps retrying till it successfully executes
+	for {
+		//# Cancellation
+		select {
+		case <-ctx.Done():
+			t.rollback() // release any ownerships held before giving up
+			t.aborted(AbortCancelled)
+			t.log(slog.LevelDebug, "stopped", "error", ctx.Err())
+			return contextError(t.metadata.name, ctx)
+		default:
+		}
+		//# Cancellation
+		t.metadata.attempt++
+		t.countAttempt()
+		if t.metadata.blocker != nil {
+			// the previous attempt aborted to break a deadlock, let the owner finish first
+			t.awaitRelease(ctx)
+		}
+		//# Scanning phase
+		t.metadata.status = false // signal that t transaction has started execution
+		if t.stm.lockingMode != ScanLocking {
+			// the readSet and writeSet are tracked while executing, no need to scan
+			t.IsScanning = false
+		} else {
+			if scErr := t.scanActions(); scErr != nil {
+				// scan the actions to determine readSet and writeSet
+				t.log(slog.LevelDebug, "failed to scan, rolling back and restarting", "error", scErr)
+				t.rollback()
+				t.aborted(AbortInconsistentRead)
+				continue
+			}
+			t.log(slog.LevelDebug, "finished scanning")
 			//# Scanning phase
 			//# Ownerships phase
-			t.log(t.metadata.name, "has started taking ownerships of writeSet members")
-			if status := t.takeOwnerships(); !status {
-				t.log(t.metadata.name, " has failed to take ownerships, rolling back and retrying")
+			if status := t.takeOwnerships(ctx); !status {
+				t.log(slog.LevelDebug, "failed to take ownerships, rolling back and retrying")
 				t.rollback()
+				t.aborted(AbortOwnershipConflict)
 				continue
 			}
-			t.log(t.metadata.name, "has taken ownerships of writeSet members")
+			t.log(slog.LevelDebug, "taken ownerships of writeSet members")
 			//# Ownerships phase
-			//# Execution phase
-			t.log(t.metadata.name, "has started execution")
-			if exStatus := t.executeActions(); !exStatus {
-				// execute all the actions for the Transaction t, upon success exStatus = true else false
-				// rollback the transaction since the actions have failed to execute successfully
-				t.rollback()
-				t.log(t.metadata.name, " has failed to execute, rolling back and restarting")
+		}
+		//# Execution phase
+		t.metadata.startVersion = t.stm.versionClock.Load() // the snapshot the actions read from
+		if exErr := t.executeActions(); exErr != nil {
+			// execute all the actions for the Transaction t, upon success exErr = nil
+			// rollback the transaction since the actions have failed to execute successfully
+			reason := t.abortReasonOf(exErr)
+			if reason == AbortRetry {
+				// an action asked to retry, so there is no point re-executing until
+				// one of the memory cells it has read changes
+				t.log(slog.LevelDebug, "retried, rolling back and waiting for readSet changes")
+				t.awaitReadSet(ctx)
 				continue
 			}
-			t.log(t.metadata.name, "has finished execution")
-			//# Execution phase
-			//# Commit phase
-			t.log(t.metadata.name, "has started commit phase")
-			if cmtStatus := t.commit(); cmtStatus {
-				// the actions of the transaction have executed successfully
-				// and the commit operation was successful
-				t.metadata.status = true // updating the status to true signifying that the transaction executed successfully
-				t.metadata.version++     // updating the version signifying successful end of the transaction
-				break
-			} else {
-				// the actions of the transaction executed properly, but,
-				// the commit operation failed, so, rollback and continue the transaction
-				// from the beginning.
-				t.log(t.metadata.name, " has failed to commit, rolling back and restarting")
+			t.rollback()
+			t.aborted(reason)
+			if reason == AbortError {
+				// the failure is not a conflict, retrying won't help, so stop for good
+				t.log(slog.LevelDebug, "failed to execute, rolling back and aborting", "error", exErr)
+				return exErr
+			}
+			t.log(slog.LevelDebug, "failed to execute, rolling back and restarting", "error", exErr)
+			continue
+		}
+		t.log(slog.LevelDebug, "finished execution")
+		//# Execution phase
+		//# Commit phase
+		if t.stm.lockingMode == CommitTimeLocking {
+			if status := t.takeOwnerships(ctx); !status {
+				t.log(slog.LevelDebug, "failed to take ownerships, rolling back and retrying")
 				t.rollback()
+				t.aborted(AbortOwnershipConflict)
 				continue
 			}
-			//# Commit phase
 		}
-		//# Transaction's execution loop, keeps retrying till it successfully executes
-		t.log(t.metadata.name, " has successfully committed.")
-		wg.Done()
-	}()
-	//# spawn and execute in new thread/goroutine
+		if cmtStatus, reason := t.commit(); !cmtStatus {
+			// the actions of the transaction executed properly, but,
+			// the commit operation failed, so, rollback and continue the transaction
+			// from the beginning.
+			t.log(slog.LevelDebug, "failed to commit, rolling back and restarting", "reason", reason.String())
+			t.rollback()
+			t.aborted(reason)
+			continue
+		}
+		// the actions of the transaction have executed successfully
+		// and the commit operation was successful
+		t.metadata.status = true // updating the status to true signifying that the transaction executed successfully
+		t.committed()
+		//# Commit phase
+		t.log(slog.LevelDebug, "committed", "version", t.metadata.version)
+		return nil
+	}
+	//# Transaction's execution loop, keeps retrying till it successfully executes
 }
 
-// scanActions scans the actions to determine
-func (t *Transaction) scanActions() {
+// runSnapshot executes the read only `Transaction t` on the calling thread/goroutine. Each execution
+// reads from a new snapshot, it is repeated only when an action retries or returns false.
+func (t *Transaction) runSnapshot(ctx context.Context) error {
+	t.IsScanning = false // read only transactions are never scanned
+	t.metadata.attempt = 0
+	for {
+		//# Cancellation
+		select {
+		case <-ctx.Done():
+			t.aborted(AbortCancelled)
+			t.log(slog.LevelDebug, "stopped", "error", ctx.Err())
+			return contextError(t.metadata.name, ctx)
+		default:
+		}
+		//# Cancellation
+		t.metadata.attempt++
+		t.countAttempt()
+		//# Execution phase
+		t.metadata.status = false // signal that t transaction has started execution
+		t.metadata.startVersion = t.stm.openSnapshot()
+		exErr := t.executeActions()
+		t.stm.closeSnapshot(t.metadata.startVersion)
+		//# Execution phase
+		if exErr != nil {
+			reason := t.abortReasonOf(exErr)
+			if reason == AbortRetry {
+				t.log(slog.LevelDebug, "retried, waiting for readSet changes")
+				t.awaitReadSet(ctx)
+				continue
+			}
+			t.rollback()
+			t.aborted(reason)
+			if reason == AbortError {
+				t.log(slog.LevelDebug, "failed to execute, aborting", "error", exErr)
+				return exErr
+			}
+			t.log(slog.LevelDebug, "failed to execute, restarting", "error", exErr)
+			continue
+		}
+		// nothing to validate or write, the snapshot was consistent
+		t.metadata.status = true
+		t.metadata.version = t.metadata.startVersion
+		t.rollback() // reset the readSet
+		t.committed()
+		t.log(slog.LevelDebug, "committed", "version", t.metadata.version)
+		return nil
+	}
+}
+
+// scanActions scans the actions to determine readSet and writeSet.
+// Returns an error only when the scan was aborted because of an inconsistent read.
+func (t *Transaction) scanActions() (err error) {
+	defer t.enterPhase(ScanPhase)()
+	t.log(slog.LevelDebug, "started scanning")
 	t.IsScanning = true // set the IsScanning flag to true to signify that the scan has started
+	t.metadata.startVersion = t.stm.versionClock.Load()
+	defer func() {
+		// retries requested, versions read and writes made while scanning don't count
+		t.metadata.retry = false
+		t.metadata.oldValues = make(map[*MemoryCell]Data, 0)
+		t.metadata.readVersions = make(map[*MemoryCell]uint64, 0)
+		t.IsScanning = false // set the IsScanning flag to false to signify that the scan has ended
+	}()
+	defer recoverAbort(&err)
 	for _, action := range t.actions {
-		action() // execute the action in scan mode, don't bother about failing
+		action(t) // execute the action in scan mode, don't bother about failing
 	}
-	t.IsScanning = false // set the IsScanning flag to false to signify that the scan has ended
+	return nil
 }
 
 // takeOwnerships signals the Ownership taking phase. If for some reason the transaction fails to take ownership, it will fail and repeat from the beginning
-func (t *Transaction) takeOwnerships() bool {
+// The ownerships are taken in the order of the `cellIndex` of the writeSet members, so that the transactions
+// writing to the same MemoryCells never wait for each other in a cycle.
+func (t *Transaction) takeOwnerships(ctx context.Context) bool {
+	defer t.enterPhase(OwnershipPhase)()
+	t.log(slog.LevelDebug, "started taking ownerships of writeSet members")
 	status := true // since there can be scenarios where there are no writeset members
-	for _, wsMemCell := range t.metadata.writeSet {
-		t.stm.stmMutex.Lock()
-		owner := t.stm._Ownerships[int(wsMemCell.cellIndex)]
-		t.stm.stmMutex.Unlock()
-		if nil == owner {
-			// since the MemoryCell is not owned by any Transactions, take ownership before
-			//# synchronized ownership acquired
-			t.stm.stmMutex.Lock()
-			t.stm._Ownerships[int(wsMemCell.cellIndex)] = t
-			t.stm.stmMutex.Unlock()
-			//# synchronized ownership acquired
+	ordered := slices.SortedFunc(slices.Values(t.metadata.writeSet), func(a, b *MemoryCell) int {
+		return cmp.Compare(a.cellIndex, b.cellIndex)
+	})
+	for _, wsMemCell := range ordered {
+		//# synchronized ownership acquired
+		// the ownership is taken only when the MemoryCell is not owned by any Transactions, checking
+		// and taking it in a single compare-and-swap, so no other transaction can take it in between
+		owner := wsMemCell.tryOwn(t)
+		//# synchronized ownership acquired
+		if owner == t {
+			// taken, or already the owner of the MemoryCell so no need to take ownership again
 			status = true
-			t.log(t.metadata.name, " has taken ownership of ", wsMemCell)
-		} else if owner == t {
-			// already the owner of the MemoryCell so no need to take ownership again
+			t.log(slog.LevelDebug, "has ownership", cellAttr(wsMemCell))
+		} else if t.resolveConflict(ctx, wsMemCell, owner) {
+			// the conflict was resolved in favor of the transaction
 			status = true
-			t.log(t.metadata.name, "  already has ownership of ", wsMemCell)
+			t.log(slog.LevelDebug, "taken ownership after resolving the conflict", cellAttr(wsMemCell))
 		} else {
 			status = false
-			t.log(t.metadata.name, "  couldn't take ownership of ", wsMemCell)
+			t.log(slog.LevelDebug, "couldn't take ownership", cellAttr(wsMemCell))
 			break
 		}
 	}
 	return status
 }
 
-// executeActions executes the actions serially, returns true if all the actions were executed successfully, else returns false.
-func (t *Transaction) executeActions() bool {
+// resolveConflict resolves the conflict with the owner of the MemoryCell using the STM's ContentionManager,
+// or by waiting for the owner when the STM waits for owners.
+// Returns true when the `Transaction t` has taken the ownership of the MemoryCell, false when it must abort,
+// including when the context is done while waiting.
+func (t *Transaction) resolveConflict(ctx context.Context, memcell *MemoryCell, owner *Transaction) bool {
+	if t.stm.waitForOwner {
+		return t.awaitOwnership(ctx, memcell)
+	}
+	for waits := 0; ; waits++ {
+		resolution, delay := t.stm.contentionManager.ResolveConflict(t, owner, waits)
+		switch resolution {
+		case Wait:
+			t.log(slog.LevelDebug, "waiting on the conflict", cellAttr(memcell), "delay", delay)
+			if !t.wait(ctx, delay) {
+				t.log(slog.LevelDebug, "stopped waiting on the conflict", cellAttr(memcell), "error", ctx.Err())
+				return false // the cancellation is reported by the next attempt
+			}
+		case AbortOther:
+			t.log(slog.LevelDebug, "taking away the ownership", cellAttr(memcell))
+		default:
+			return false
+		}
+		//# synchronized ownership acquired
+		// the owner might have released the MemoryCell in the meantime, or even another transaction
+		// might have taken it, in which case the conflict is with the new owner
+		current := memcell.tryOwn(t)
+		if current == owner && resolution == AbortOther && memcell.steal(owner, t) {
+			current = t
+		}
+		if current == t {
+			t.stm.releases.notify(memcell) // the transactions waiting for the owner now wait for t
+			return true
+		}
+		//# synchronized ownership acquired
+		if current != owner {
+			owner, waits = current, -1 // a new conflict
+		}
+	}
+}
+
+// wait blocks for the delay, returns false when the context is done before it has passed.
+func (t *Transaction) wait(ctx context.Context, delay time.Duration) bool {
+	t.contention.waiting.Store(true)
+	defer t.contention.waiting.Store(false)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Karma gets the number of MemoryCells opened by the transaction since it started executing, including
+// the aborted attempts. It is used by the ContentionManagers as the priority of the transaction.
+func (t *Transaction) Karma() int64 {
+	return t.contention.karma.Load()
+}
+
+// StartTime gets the time the transaction started executing. Retries don't reset it, so a transaction
+// that keeps aborting gets older. It is used by the ContentionManagers as the priority of the transaction.
+func (t *Transaction) StartTime() time.Time {
+	return time.Unix(0, t.contention.startTime.Load())
+}
+
+// IsWaiting checks if the transaction is waiting on a conflict.
+func (t *Transaction) IsWaiting() bool {
+	return t.contention.waiting.Load()
+}
+
+// executeActions executes the actions serially, returns nil if all the actions were executed successfully, else returns the error of the failed action.
+func (t *Transaction) executeActions() (err error) {
+	defer t.enterPhase(ExecutionPhase)()
+	t.log(slog.LevelDebug, "started execution", "snapshot", t.metadata.startVersion)
+	defer recoverAbort(&err)
 	for _, action := range t.actions {
-		status := action()
-		if !status {
+		if err := action(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extendSnapshot tries to move the snapshot of the `Transaction t` forward to the current version of the
+// STM's clock. It succeeds only when none of the MemoryCells read so far have been committed since.
+// The clock is read before validating, the commits it covers that are half way through hold the locks of
+// the MemoryCells they write to, so validating waits for them.
+func (t *Transaction) extendSnapshot() bool {
+	startVersion := t.stm.versionClock.Load()
+	for memcell, readVersion := range t.metadata.readVersions {
+		if memcell.currentVersion() != readVersion {
 			return false
 		}
 	}
+	t.metadata.startVersion = startVersion
 	return true
 }
 
+// abortSignal is the panic value used for unwinding the actions of an aborted execution.
+type abortSignal struct {
+	err error
+}
+
+// abort aborts the current execution of the `Transaction t`, unwinding its actions.
+// The error is reported by `scanActions` or `executeActions`.
+func (t *Transaction) abort(err error) {
+	t.metadata.retry = false // the data that led to a retry can't be trusted
+	panic(abortSignal{err: err})
+}
+
+// recoverAbort recovers from an abort, storing its error into err. Any other panic is propagated.
+// usage:
+// defer recoverAbort(&err)
+func recoverAbort(err *error) {
+	if r := recover(); r != nil {
+		signal, aborted := r.(abortSignal)
+		if !aborted {
+			panic(r)
+		}
+		*err = signal.err
+	}
+}
+
 // rollback rolls back the `Transaction t`.
 // Releasing the ownerships held by the transaction.
 func (t *Transaction) rollback() {
 	// to rollback the transaction, restore the backups in the
 	// Transaction's metadata called oldValues.
-	for _, wsMemCell := range t.metadata.writeSet {
-		//# release ownership
-		t.stm.stmMutex.Lock()
-		if t.stm._Ownerships[int(wsMemCell.cellIndex)] == t {
-			t.stm._Ownerships[int(wsMemCell.cellIndex)] = nil // releases ownership
-		}
-		t.stm.stmMutex.Unlock()
-		//# release ownership
-	}
+	t.releaseOwnerships(t.metadata.writeSet)
 	//# reset the writeSet, readSet, and oldValues
 	t.metadata.readSet = make([]*MemoryCell, 0)
 	t.metadata.writeSet = make([]*MemoryCell, 0)
 	t.metadata.oldValues = make(map[*MemoryCell]Data, 0)
+	t.metadata.readVersions = make(map[*MemoryCell]uint64, 0)
+	t.metadata.commutes = make(map[*MemoryCell][]func(Data) Data, 0)
+	t.metadata.retry = false
+	t.metadata.conflicted = false
 	//# reset the writeSet, readSet, and oldValues
 }
 
+// releaseOwnerships releases the ownerships of the memory cells held by the `Transaction t`.
+func (t *Transaction) releaseOwnerships(memcells []*MemoryCell) {
+	for _, memcell := range memcells {
+		//# release ownership
+		// releases ownership, unless it was taken away
+		if held, released := memcell.release(t); released {
+			t.countHold(held)
+		}
+		t.stm.releases.notify(memcell) // wake up the transactions waiting for the owner
+		//# release ownership
+	}
+}
+
+// orElse executes the alternatives one after the other until one of them succeeds.
+func (t *Transaction) orElse(alternatives []func(*Transaction) error) (err error) {
+	if t.IsScanning {
+		// scan all the alternatives, so that the readSet and writeSet cover all of them
+		for _, alternative := range alternatives {
+			alternative(t)
+		}
+		return nil
+	}
+	for _, alternative := range alternatives {
+		//# take a backup of oldValues, so that the alternative's writes can be discarded
+		backups := maps.Clone(t.metadata.oldValues)
+		commutes := maps.Clone(t.metadata.commutes)
+		written := len(t.metadata.writeSet)
+		t.metadata.retry = false
+		//# take a backup of oldValues, so that the alternative's writes can be discarded
+		if err = alternative(t); err == nil {
+			return nil
+		}
+		if !t.metadata.retry && !errors.Is(err, ErrRetry) {
+			// a conflict restarts the whole transaction, a permanent failure stops it,
+			// either way there is no point trying the other alternatives
+			return err
+		}
+		//# discard the tentative writes of the alternative
+		for _, wsMemCell := range t.metadata.writeSet {
+			if backup, ok := backups[wsMemCell]; ok {
+				t.metadata.oldValues[wsMemCell] = backup
+			} else {
+				delete(t.metadata.oldValues, wsMemCell)
+			}
+		}
+		t.metadata.commutes = commutes
+		// the MemoryCells first written by the alternative are no longer part of the writeSet
+		t.releaseOwnerships(t.metadata.writeSet[written:])
+		t.metadata.writeSet = t.metadata.writeSet[:written]
+		//# discard the tentative writes of the alternative
+		t.log(slog.LevelDebug, "alternative has failed, discarded its writes", "error", err)
+	}
+	return err
+}
+
+// Retry signals that the transaction cannot proceed with the current state of the memory cells.
+// The transaction is rolled back and blocks until at least one of the MemoryCells in its readSet is
+// committed by another transaction, then it is executed again from the beginning.
+// Retry returns `ErrRetry`, which should be returned by the action. Inside actions chained using `Do`
+// returning false after calling Retry has the same effect.
+// > Note: A transaction that retries without reading any MemoryCell blocks until its context is done.
+// usage:
+// DoErr(func(t *stm.Transaction) error {
+// 	if stm.ReadTVar(t, stock) == 0 {
+// 		return t.Retry() // wait until someone restocks
+// 	}
+// 	...
+// })
+func (t *Transaction) Retry() error {
+	t.metadata.retry = true
+	return ErrRetry
+}
+
+// awaitReadSet rolls back the `Transaction t` and blocks until one of its readSet members is committed
+// by another transaction or the context is done.
+func (t *Transaction) awaitReadSet(ctx context.Context) {
+	defer t.enterPhase(WaitPhase)()
+	readSet := t.metadata.readSet
+	readVersions := t.metadata.readVersions
+	//# register before releasing the ownerships, so that no commit is missed
+	wakeup := t.stm.waiters.register(readSet)
+	defer t.stm.waiters.unregister(readSet, wakeup)
+	t.rollback()
+	t.aborted(AbortRetry)
+	//# register before releasing the ownerships, so that no commit is missed
+	//# check for commits made before registering
+	for _, rsMemCell := range readSet {
+		readVersion, read := readVersions[rsMemCell]
+		if !read {
+			continue
+		}
+		if readVersion != rsMemCell.currentVersion() {
+			t.log(slog.LevelDebug, "readSet member has already changed, no need to wait", cellAttr(rsMemCell))
+			return
+		}
+	}
+	//# check for commits made before registering
+	select {
+	case <-wakeup:
+		t.log(slog.LevelDebug, "woken up by a readSet change")
+	case <-ctx.Done():
+	}
+}
+
 // commit commits the Transaction t. After committing, the Transaction releases the ownership of the MemoryCells and their values become visible to all the other transactions.
-// Commit depends on the readSet members. If the value of the readSet members have changed in the meantime,
+// Commit depends on the readSet members. If the version of the readSet members have changed in the meantime,
 // the commit should fail and the Transaction should rollback and restart from the beginning.
-// The commit failure is signified by a `cmtStatus = false`. The success is represented as `cmtStatus = true`.
-func (t *Transaction) commit() (cmtStatus bool) {
+// The written MemoryCells are stamped with the commit timestamp taken from the STM's version clock.
+// The writeSet members are locked for the whole commit, the readSet members are only checked, so the
+// transactions committing disjoint MemoryCells never wait for each other.
+// The commit failure is signified by a `cmtStatus = false`, along with the `reason`. The success is represented as `cmtStatus = true`.
+func (t *Transaction) commit() (cmtStatus bool, reason AbortReason) {
+	defer t.enterPhase(CommitPhase)()
+	t.log(slog.LevelDebug, "started committing")
 	cmtStatus = true // let's assume we have a successful commit
+	//# lock the writeSet members
+	// in the order of their cellIndex, so that the committing transactions never wait for each other in a cycle
+	// the MemoryCells updated commutatively are locked along with them, they aren't owned
+	locked := slices.AppendSeq(slices.Clone(t.metadata.writeSet), maps.Keys(t.metadata.commutes))
+	slices.SortFunc(locked, func(a, b *MemoryCell) int {
+		return cmp.Compare(a.cellIndex, b.cellIndex)
+	})
+	locked = slices.Compact(locked) // a writeSet member can be updated commutatively too
+	for _, wsMemCell := range locked {
+		wsMemCell.mutex.Lock()
+	}
+	//# lock the writeSet members
+	//# check ownership of MemoryCells in the write set
+	// the write set members must still be owned by the transaction
+	// otherwise fail the commit and let the transaction retry
+	writes := 0
+	for _, wsMemCell := range t.metadata.writeSet {
+		if wsMemCell.owner.Load() != t {
+			// the writeset member is no longer held by the transaction
+			// it is not safe to write, so the transaction should fail and retry
+			t.log(slog.LevelDebug, "lost ownership, commit failed", cellAttr(wsMemCell))
+			cmtStatus, reason = false, AbortLostOwnership // commit failed
+			break
+		}
+		if _, written := t.metadata.oldValues[wsMemCell]; written {
+			writes++
+		}
+	}
+	//# check ownership of MemoryCells in the write set
+	writes += len(t.metadata.commutes)
+	//# take the commit timestamp
+	// a read only commit is as recent as the clock
+	// the clock is incremented only after locking the writeSet members, so that the transactions
+	// reading from a snapshot that includes the commit wait for it to finish
+	t.metadata.version = t.stm.versionClock.Load()
+	if cmtStatus && writes > 0 {
+		t.metadata.version = t.stm.versionClock.Add(1)
+	}
+	//# take the commit timestamp
 	//# check readSet members for inconsistencies
 	for _, rsMemCell := range t.metadata.readSet {
-		backup := t.metadata.oldValues[rsMemCell] // get the Transaction's backup to compare against the current state in STM
-		t.stm.stmMutex.Lock()
-		current := t.stm._Memory[rsMemCell.cellIndex].readData()
-		t.stm.stmMutex.Unlock()
-		t.log(t.metadata.name, "backup = ", backup, "and current value = ", current)
-		if !reflect.DeepEqual(backup, current) && !contains(t.metadata.writeSet, rsMemCell) {
-			// since the backup and current values don't match
-			// there might be a modification and the this Transaction's
-			// computation might be wrong now, need to rollback and retry
-			t.log(t.metadata.name, "Readset member's Old and current values don't match -- failed")
-			cmtStatus = false
+		if !cmtStatus {
+			break
+		}
+		readVersion, read := t.metadata.readVersions[rsMemCell] // get the version the Transaction has read to compare against the current version in STM
+		if !read {
+			// the readSet member was not read during execution, say, the alternative of
+			// `OrElse` reading it was not taken, so its value doesn't matter
+			continue
+		}
+		var current uint64
+		if contains(locked, rsMemCell) {
+			current = rsMemCell.version // already locked
+		} else if rsMemCell.mutex.TryRLock() {
+			current = rsMemCell.version
+			rsMemCell.mutex.RUnlock()
+		} else {
+			// another transaction is committing the readSet member, waiting for it could deadlock
+			t.log(slog.LevelDebug, "readSet member is being committed, commit failed", cellAttr(rsMemCell))
+			cmtStatus, reason = false, AbortReadValidation
 			break
 		}
+		if readVersion != current {
+			// since the versions don't match, another transaction has committed
+			// the readSet member and the this Transaction's
+			// computation might be wrong now, need to rollback and retry
+			t.log(slog.LevelDebug, "readSet member has changed, commit failed", cellAttr(rsMemCell), "read", readVersion, "current", current)
+			cmtStatus, reason = false, AbortReadValidation
+		}
 	}
 	//# check readSet members for inconsistencies
-	//# release ownership of MemoryCells in the write set
 	// only release ownership in case of successful commit
 	// otherwise the ownership will be released by the rollback subroutine
+	written := make([]*MemoryCell, 0, writes)
 	if cmtStatus {
+		//# write new values to the memory location
+		// the write set members are still owned by the transaction, it is safe to write
+		// the writeSet members that were not touched during execution, say, because their
+		// writes were discarded by `OrElse`, are left as they are
+		// with no snapshot open, the older versions are not kept and the registry isn't touched
+		var snapshots []uint64
+		if writes > 0 && t.stm.openSnapshots.Load() > 0 {
+			snapshots = t.stm.activeSnapshots()
+		}
 		for _, wsMemCell := range t.metadata.writeSet {
-			// first check if the write set members still hold the ownerships
-			// otherwise fail the commit and let the transaction retry
-			t.stm.stmMutex.Lock()
-			owner := t.stm._Ownerships[int(wsMemCell.cellIndex)]
-			t.stm.stmMutex.Unlock()
-			if owner == t {
-				// the write set member is still owned by the transaction
-				// it is safe to write
-				//# write new values to the memory location
-				newData := t.metadata.oldValues[wsMemCell]
-				t.log(t.metadata.name, "Preparing to write data into memcell, data = ", newData, " and memcell = ", wsMemCell)
-				t.stm.stmMutex.Lock()
-				t.stm._Memory[wsMemCell.cellIndex].writeData(newData) // write the new updated data
-				//# write new values to the memory location
-				//# release ownership
-				//# synchronized release of ownership
-				t.stm._Ownerships[int(wsMemCell.cellIndex)] = nil
-				//# synchronized release of ownership
-				//# release ownership
-				t.stm.stmMutex.Unlock()
-				t.log(t.metadata.name, "Wrote data into memcell, data = ", newData, " and memcell = ", wsMemCell)
-			} else {
-				// the writeset member is no longer held by the transaction
-				// it is not safe to write, so the transaction should fail and retry
-				cmtStatus = false // commit failed
-				break             // break, need to fail the commit
+			if newData, touched := t.metadata.oldValues[wsMemCell]; touched {
+				wsMemCell.commitData(newData, t.metadata.version, snapshots) // write the new updated data
+				if len(snapshots) > 0 {
+					t.stm.trackHistory(wsMemCell)
+				}
+				written = append(written, wsMemCell)
+				t.log(slog.LevelDebug, "wrote data", cellAttr(wsMemCell), "data", newData)
 			}
+			//# synchronized release of ownership
+			if held, released := wsMemCell.release(t); released {
+				t.countHold(held)
+			}
+			//# synchronized release of ownership
+		}
+		for memcell, updates := range t.metadata.commutes {
+			// the MemoryCell is locked, so its latest data can't change in the meantime
+			newData := memcell.readData()
+			for _, update := range updates {
+				newData = update(newData)
+			}
+			memcell.commitData(newData, t.metadata.version, snapshots)
+			if len(snapshots) > 0 {
+				t.stm.trackHistory(memcell)
+			}
+			written = append(written, memcell)
+			t.log(slog.LevelDebug, "applied the commutative updates", cellAttr(memcell), "data", newData)
+		}
+		//# write new values to the memory location
+	}
+	for _, wsMemCell := range locked {
+		wsMemCell.mutex.Unlock()
+	}
+	for _, memcell := range written {
+		t.stm.waiters.notify(memcell) // wake up the transactions waiting in Retry
+	}
+	if cmtStatus {
+		for _, memcell := range t.metadata.writeSet {
+			t.stm.releases.notify(memcell) // wake up the transactions waiting for the owner
 		}
 	}
-	//# release ownership of MemoryCells in the write set
 	if cmtStatus {
 		//# reset the writeSet, readSet, and oldValues
 		t.metadata.readSet = make([]*MemoryCell, 0)
 		t.metadata.writeSet = make([]*MemoryCell, 0)
 		t.metadata.oldValues = make(map[*MemoryCell]Data, 0)
+		t.metadata.readVersions = make(map[*MemoryCell]uint64, 0)
+		t.metadata.commutes = make(map[*MemoryCell][]func(Data) Data, 0)
 		//# reset the writeSet, readSet, and oldValues
 	}
-	return cmtStatus
+	return cmtStatus, reason
 }
 
 //# For debugging
 
-// GetVersion gets the version of the transaction
-func (t *Transaction) GetVersion() int {
-	return t.metadata.version
+// GetVersion gets the version of the transaction, the commit timestamp of its latest successful execution.
+func (t *Transaction) GetVersion() uint64 {
+	if t.template != nil {
+		return t.metadata.version // an execution, passed to the hooks and the ContentionManagers
+	}
+	return t.latest.Load()
 }
 
-// log logs the messages to stderr/stdout depending on the debug flag
-func (t *Transaction) log(msgs ...interface{}) {
-	if debugFlag {
-		log.Println(msgs...)
+// log logs the message through the STM's logger, at the level, along with the attributes of the
+// transaction - its name, the attempt and the phase - and the attributes passed, as key-value pairs
+// or `slog.Attr`s.
+// usage:
+// t.log(slog.LevelDebug, "has ownership", cellAttr(memcell))
+func (t *Transaction) log(level slog.Level, msg string, args ...any) {
+	if !t.stm.logger.Enabled(context.Background(), level) {
+		return // don't bother building the attributes
+	}
+	attrs := []any{
+		slog.String("transaction", t.metadata.name),
+		slog.Int("attempt", t.metadata.attempt),
+		slog.String("phase", t.metadata.phase.String()),
 	}
+	t.stm.logger.Log(context.Background(), level, msg, append(attrs, args...)...)
+}
+
+// cellAttr makes the logging attribute of the MemoryCell, its index.
+func cellAttr(memcell *MemoryCell) slog.Attr {
+	return slog.Uint64("cell", uint64(memcell.cellIndex))
 }
 
 //# For debugging
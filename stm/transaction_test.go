@@ -0,0 +1,391 @@
+package stm
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// box is a mutable transactional variable of the tests.
+type box struct {
+	values []int
+}
+
+func (b *box) Clone() Data {
+	return &box{values: append([]int(nil), b.values...)}
+}
+
+func TestConcurrentExecutionsOfTemplate(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		total := NewTVar(s, 0)
+		tr := s.NewT().
+			Where("scratch", &box{values: []int{0}}).
+			Do(func(tx *Transaction) bool {
+				increment := 0
+				if scratch, ok := tx.GetTVar("scratch").(*box); ok {
+					// each execution mutates its own clone, the others never see the changes
+					scratch.values[0]++
+					scratch.values = append(scratch.values, len(scratch.values))
+					increment = scratch.values[0]
+				}
+				return WriteTVar(tx, total, ReadTVar(tx, total)+increment)
+			}).
+			Done()
+		if err := s.Exec(tr, tr, tr, tr); err != nil {
+			t.Fatal(err)
+		}
+		// an execution may restart, seeing its own changes, but never the changes of the others
+		if value := readTVar(s, total); value < 4 {
+			t.Fatalf("%v: total is %d", mode, value)
+		}
+		if scratch := tr.tvars["scratch"].(*box); len(scratch.values) != 1 || scratch.values[0] != 0 {
+			t.Fatalf("%v: the template's variable was changed to %v", mode, scratch.values)
+		}
+	}
+}
+
+func TestTransferInvariant(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		accounts := make([]*TVar[int], 8)
+		for i := range accounts {
+			accounts[i] = NewTVar(s, 100)
+		}
+		ts := make([]*Transaction, 0)
+		for i := range 400 {
+			from, to := accounts[i%len(accounts)], accounts[(i*5+3)%len(accounts)]
+			ts = append(ts, s.NewT().DoErr(func(tx *Transaction) error {
+				balance := ReadTVar(tx, from)
+				if balance < 10 {
+					return nil // insufficient funds, nothing to transfer
+				}
+				if !WriteTVar(tx, from, balance-10) || !WriteTVar(tx, to, ReadTVar(tx, to)+10) {
+					return ErrConflict
+				}
+				return nil
+			}).Done())
+		}
+		// the audits run along with the transfers, they must never see money made or lost
+		var bad atomic.Int64
+		audit := func(tc *TransactionContext) *Transaction {
+			return tc.Do(func(tx *Transaction) bool {
+				total := 0
+				for _, account := range accounts {
+					total += ReadTVar(tx, account)
+				}
+				if total != 100*len(accounts) {
+					bad.Add(1)
+				}
+				return true
+			}).Done()
+		}
+		for range 20 {
+			ts = append(ts, audit(s.NewT()), audit(s.NewReadOnlyT()))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		for _, err := range s.ExecContext(ctx, ts...) {
+			if err != nil {
+				t.Fatalf("%v: %v", mode, err)
+			}
+		}
+		cancel()
+		if bad.Load() != 0 {
+			t.Fatalf("%v: %d audits saw an inconsistent total", mode, bad.Load())
+		}
+		total := 0
+		for _, account := range accounts {
+			total += readTVar(s, account)
+		}
+		if total != 100*len(accounts) {
+			t.Fatalf("%v: total is %d", mode, total)
+		}
+	}
+}
+
+// pausing pauses a transaction on its first attempt, until another transaction has committed.
+type pausing struct {
+	paused, resume chan struct{}
+	once           sync.Once
+}
+
+func newPausing() *pausing {
+	return &pausing{paused: make(chan struct{}), resume: make(chan struct{})}
+}
+
+// pause blocks the first attempt not in its scan phase.
+func (p *pausing) pause(tx *Transaction) {
+	if tx.IsScanning {
+		return
+	}
+	p.once.Do(func() {
+		close(p.paused)
+		<-p.resume
+	})
+}
+
+// interleave executes the paused transaction and, once it has paused, the other transaction.
+func (p *pausing) interleave(t *testing.T, s *STM, paused, other *Transaction) {
+	done := make(chan error)
+	go func() { done <- s.Exec(paused) }()
+	<-p.paused
+	if err := s.Exec(other); err != nil {
+		t.Fatal(err)
+	}
+	close(p.resume)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpacityAbort(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		x, y := NewTVar(s, 0), NewTVar(s, 0)
+		p := newPausing()
+		seen := make([][2]int, 0)
+		reasons := make([]AbortReason, 0)
+		reader := s.NewT().Do(func(tx *Transaction) bool {
+			a := ReadTVar(tx, x)
+			p.pause(tx)
+			// y was committed after x was read, the execution is aborted before seeing it
+			seen = append(seen, [2]int{a, ReadTVar(tx, y)})
+			return true
+		}).OnAbort(func(reason AbortReason) { reasons = append(reasons, reason) }).Done()
+		writer := s.NewT().Do(func(tx *Transaction) bool {
+			return WriteTVar(tx, x, 1) && WriteTVar(tx, y, -1)
+		}).Done()
+		p.interleave(t, s, reader, writer)
+		for _, pair := range seen {
+			if pair[0]+pair[1] != 0 {
+				t.Fatalf("%v: the reader saw x = %d with y = %d", mode, pair[0], pair[1])
+			}
+		}
+		if !slices.Contains(reasons, AbortInconsistentRead) {
+			t.Fatalf("%v: the reader wasn't aborted, %v", mode, reasons)
+		}
+	}
+}
+
+func TestCommitValidation(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		x, y := NewTVar(s, 0), NewTVar(s, 0)
+		p := newPausing()
+		copier := s.NewT().Do(func(tx *Transaction) bool {
+			a := ReadTVar(tx, x)
+			p.pause(tx)
+			// x is never read again, the commit finds it stale
+			return WriteTVar(tx, y, a)
+		}).Done()
+		writer := s.NewT().Do(func(tx *Transaction) bool {
+			return WriteTVar(tx, x, 1)
+		}).Done()
+		p.interleave(t, s, copier, writer)
+		if value := readTVar(s, y); value != 1 {
+			t.Fatalf("%v: committed a copy of a stale read, %d", mode, value)
+		}
+	}
+}
+
+var errFunds = errors.New("insufficient funds")
+
+func TestDoErrStopsOnPermanentError(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		account := NewTVar(s, 50)
+		runs := 0
+		withdraw := s.NewT().DoErr(func(tx *Transaction) error {
+			runs++
+			balance := ReadTVar(tx, account)
+			if balance < 100 {
+				return errFunds
+			}
+			if !WriteTVar(tx, account, balance-100) {
+				return ErrConflict
+			}
+			return nil
+		}).Done()
+		if err := s.Exec(withdraw); !errors.Is(err, errFunds) {
+			t.Fatalf("%v: %v", mode, err)
+		}
+		if runs > 2 { // the scan, then a single execution
+			t.Fatalf("%v: retried a permanent error, %d runs", mode, runs)
+		}
+		if value := readTVar(s, account); value != 50 {
+			t.Fatalf("%v: the failed transaction left %d behind", mode, value)
+		}
+	}
+}
+
+func TestRetryBlocks(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		stock := NewTVar(s, 0)
+		var runs atomic.Int64
+		consumer := s.NewT().DoErr(func(tx *Transaction) error {
+			runs.Add(1)
+			n := ReadTVar(tx, stock)
+			if n == 0 {
+				return tx.Retry()
+			}
+			if !WriteTVar(tx, stock, n-1) {
+				return ErrConflict
+			}
+			return nil
+		}).Done()
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			s.Exec(s.NewT().Do(func(tx *Transaction) bool {
+				return WriteTVar(tx, stock, ReadTVar(tx, stock)+1)
+			}).Done())
+		}()
+		if err := s.Exec(consumer); err != nil {
+			t.Fatal(err)
+		}
+		if runs.Load() > 6 {
+			t.Fatalf("%v: spun %d times waiting for the stock", mode, runs.Load())
+		}
+		if value := readTVar(s, stock); value != 0 {
+			t.Fatalf("%v: stock is %d", mode, value)
+		}
+	}
+}
+
+func TestOrElse(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		a, b, attempts := NewTVar(s, 0), NewTVar(s, 2), NewTVar(s, 0)
+		take := func(queue *TVar[int]) func(*Transaction) error {
+			return func(tx *Transaction) error {
+				if !WriteTVar(tx, attempts, ReadTVar(tx, attempts)+1) {
+					return ErrConflict
+				}
+				n := ReadTVar(tx, queue)
+				if n == 0 {
+					return tx.Retry() // the write to attempts is discarded
+				}
+				if !WriteTVar(tx, queue, n-1) {
+					return ErrConflict
+				}
+				return nil
+			}
+		}
+		tr := s.NewT().OrElse(take(a), take(b)).Done()
+		for range 2 {
+			if err := s.Exec(tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if readTVar(s, b) != 0 || readTVar(s, attempts) != 2 {
+			t.Fatalf("%v: b = %d, attempts = %d", mode, readTVar(s, b), readTVar(s, attempts))
+		}
+		// both alternatives retry, the transaction blocks until either changes
+		go func() {
+			time.Sleep(30 * time.Millisecond)
+			s.Exec(s.NewT().Do(func(tx *Transaction) bool { return WriteTVar(tx, a, 1) }).Done())
+		}()
+		if err := s.Exec(tr); err != nil {
+			t.Fatal(err)
+		}
+		if readTVar(s, a) != 0 || readTVar(s, attempts) != 3 {
+			t.Fatalf("%v: a = %d, attempts = %d", mode, readTVar(s, a), readTVar(s, attempts))
+		}
+	}
+}
+
+func TestOrElseRestartsOnConflict(t *testing.T) {
+	s := NewSTM()
+	s.SetLockingMode(EncounterTimeLocking)
+	a, b := NewTVar(s, 1), NewTVar(s, 0)
+	take := func(queue *TVar[int]) func(*Transaction) error {
+		return func(tx *Transaction) error {
+			n := ReadTVar(tx, queue)
+			if n == 0 {
+				return tx.Retry()
+			}
+			if !WriteTVar(tx, queue, n-1) {
+				return ErrConflict
+			}
+			return nil
+		}
+	}
+	// the holder owns a, then rolls back, so the transactions waiting for a to change are never woken up
+	owned, release := make(chan struct{}), make(chan struct{})
+	holder := s.NewT().DoErr(func(tx *Transaction) error {
+		if !WriteTVar(tx, a, 100) {
+			return ErrConflict
+		}
+		close(owned)
+		<-release
+		return errPermanent
+	}).Done()
+	done := make(chan error)
+	go func() { done <- s.Exec(holder) }()
+	<-owned
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		close(release)
+	}()
+	// taking from a conflicts and b retries, the transaction restarts instead of waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tr := s.NewT().OrElse(take(a), take(b)).Done()
+	if err := s.ExecContext(ctx, tr)[0]; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != errPermanent {
+		t.Fatal(err)
+	}
+	if readTVar(s, a) != 0 || readTVar(s, b) != 0 {
+		t.Fatalf("a = %d, b = %d", readTVar(s, a), readTVar(s, b))
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		tvar := NewTVar(s, 0)
+		never := s.NewT().Do(func(tx *Transaction) bool {
+			return WriteTVar(tx, tvar, ReadTVar(tx, tvar)+1) && false
+		}).Done("never")
+		blocked := s.NewT().DoErr(func(tx *Transaction) error {
+			if ReadTVar(tx, tvar) == 0 {
+				return tx.Retry()
+			}
+			return nil
+		}).Done("blocked")
+		ok := s.NewT().Do(func(tx *Transaction) bool { return true }).Done("ok")
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		errs := s.ExecContext(ctx, never, blocked, ok)
+		cancel()
+		if !errors.Is(errs[0], ErrTimedOut) || !errors.Is(errs[1], ErrTimedOut) || errs[2] != nil {
+			t.Fatalf("%v: %v", mode, errs)
+		}
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		if err := s.ExecContext(ctx, never)[0]; !errors.Is(err, ErrCancelled) {
+			t.Fatalf("%v: %v", mode, err)
+		}
+		// a transaction cancelled before it starts never attempts to execute
+		stopped := s.NewT().Do(func(tx *Transaction) bool { return true }).Done()
+		if err := s.ExecContext(ctx, stopped)[0]; !errors.Is(err, ErrCancelled) || stopped.Stats().Attempts != 0 {
+			t.Fatalf("%v: %v, %d attempts", mode, err, stopped.Stats().Attempts)
+		}
+		if value := readTVar(s, tvar); value != 0 {
+			t.Fatalf("%v: the stopped transactions left %d behind", mode, value)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/**
+* tvar.go
+* @description Typed transactional variables built on top of `MemoryCell`s.
+ */
+
+package stm
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// TVar represents a typed transactional variable. It is backed by a `MemoryCell` so it
+// takes part in transactions just like any other `MemoryCell`, but the consumer neither has
+// to implement `Data` nor type assert the values read out of it.
+// `cell`: The MemoryCell holding the value of the TVar
+// `clone`: The function used to copy the value whenever it goes in or out of the MemoryCell
+type TVar[T any] struct {
+	cell  *MemoryCell
+	clone func(T) T
+}
+
+// tvarData is the `Data` stored inside the MemoryCell of a TVar.
+type tvarData[T any] struct {
+	value T
+	tvar  *TVar[T]
+}
+
+// Clone provides a copy of the value using the TVar's clone function.
+func (d *tvarData[T]) Clone() Data {
+	return &tvarData[T]{value: d.tvar.clone(d.value), tvar: d.tvar}
+}
+
+// NewTVar makes a new `TVar` holding the value. The optional clone function is used to copy
+// the value, when it is not provided `CloneDefault` is used.
+// usage:
+// balance := stm.NewTVar(MySTM, 100)
+// accounts := stm.NewTVar(MySTM, []int{1, 2, 3}, stm.CloneSlice[[]int])
+func NewTVar[T any](stm *STM, value T, clone ...func(T) T) *TVar[T] {
+	return newTVar(stm.MakeMemCell, value, clone)
+}
+
+// NewTransientTVar makes a new `TVar` holding the value, just like `NewTVar`, but its MemoryCell is
+// made using `MakeTransientMemCell`, so it is garbage collected along with the TVar.
+// usage:
+// next := stm.NewTransientTVar[*node](MySTM, nil, stm.CloneValue)
+func NewTransientTVar[T any](stm *STM, value T, clone ...func(T) T) *TVar[T] {
+	return newTVar(stm.MakeTransientMemCell, value, clone)
+}
+
+// newTVar makes a new TVar holding the value, in a MemoryCell made by makeCell.
+func newTVar[T any](makeCell func(Data) *MemoryCell, value T, clone []func(T) T) *TVar[T] {
+	tvar := new(TVar[T])
+	tvar.clone = CloneDefault[T]
+	if len(clone) != 0 && clone[0] != nil {
+		tvar.clone = clone[0]
+	}
+	tvar.cell = makeCell(&tvarData[T]{value: tvar.clone(value), tvar: tvar})
+	return tvar
+}
+
+// Cell gets the `MemoryCell` backing the TVar.
+func (tvar *TVar[T]) Cell() *MemoryCell {
+	return tvar.cell
+}
+
+// ReadTVar a transactional read operation on the TVar. It is the typed counterpart of `ReadT`,
+// the value returned is a copy and can be modified freely.
+// usage:
+// balance := stm.ReadTVar(t, balanceVar)
+func ReadTVar[T any](t *Transaction, tvar *TVar[T]) T {
+	return t.ReadT(tvar.cell).(*tvarData[T]).value
+}
+
+// WriteTVar a transactional write operation on the TVar. It is the typed counterpart of `WriteT`,
+// returns true when the value is successfully written into the TVar. The value is copied, so later
+// modifications made by the caller don't leak into the transaction.
+// usage:
+// return stm.WriteTVar(t, balanceVar, balance-100)
+func WriteTVar[T any](t *Transaction, tvar *TVar[T], value T) bool {
+	return t.WriteT(tvar.cell, &tvarData[T]{value: tvar.clone(value), tvar: tvar})
+}
+
+// CommuteTVar a transactional commutative update operation on the TVar. It is the typed counterpart
+// of `CommuteT`, the update is applied to the latest value of the TVar when committing, so the
+// transactions updating the TVar commutatively never conflict with each other.
+// usage:
+// stm.CommuteTVar(t, hits, func(n int) int { return n + 1 })
+func CommuteTVar[T any](t *Transaction, tvar *TVar[T], update func(T) T) {
+	t.CommuteT(tvar.cell, func(data Data) Data {
+		return &tvarData[T]{value: update(data.(*tvarData[T]).value), tvar: tvar}
+	})
+}
+
+//# Clone functions
+
+// CloneValue returns the value as is. It is suitable for value types - numbers, strings, structs
+// without references - and for immutable values, or values whose memory must be shared.
+func CloneValue[T any](value T) T {
+	return value
+}
+
+// CloneSlice returns a shallow copy of the slice.
+func CloneSlice[S ~[]E, E any](value S) S {
+	return slices.Clone(value)
+}
+
+// CloneMap returns a shallow copy of the map.
+func CloneMap[M ~map[K]V, K comparable, V any](value M) M {
+	return maps.Clone(value)
+}
+
+// CloneDefault is the clone function used when a TVar is made without one.
+// If the value implements `Data`, its `Clone` is used, else the value is copied by an assignment. That
+// suits value types - numbers, strings, structs without references - and immutable values.
+// > Note: The assignment doesn't copy the memory the value refers to. Types holding references - slices,
+// maps, pointers, structs with such fields - need an explicit clone function, say, `CloneSlice`, `CloneMap`
+// or one of their own, else the transactions share that memory with the committed data.
+func CloneDefault[T any](value T) T {
+	if data, ok := any(value).(Data); ok && !isNil(value) {
+		return data.Clone().(T)
+	}
+	return value
+}
+
+// isNil checks if the value is a nil pointer, map, slice, etc.
+func isNil[T any](value T) bool {
+	rv := reflect.ValueOf(any(value))
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+//# Clone functions
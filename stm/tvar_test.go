@@ -0,0 +1,59 @@
+package stm
+
+import (
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestCloneDefault(t *testing.T) {
+	s := NewSTM()
+	// a value not implementing Data is assigned, keeping its identity
+	eof := NewTVar[error](s, io.EOF)
+	if err := readTVar(s, eof); err != io.EOF {
+		t.Fatalf("read %v", err)
+	}
+	original := &box{values: []int{1}}
+	clone := CloneDefault(original)
+	clone.values[0] = 2
+	if clone == original || original.values[0] != 1 {
+		t.Fatalf("the Data wasn't cloned, %v", original.values)
+	}
+}
+
+func TestTVarIsolatesReferences(t *testing.T) {
+	s := NewSTM()
+	tvar := NewTVar(s, []int{0}, CloneSlice[[]int])
+	failed := s.NewT().Do(func(tx *Transaction) bool {
+		history := ReadTVar(tx, tvar)
+		history[0] = 1 // never written, so it must not leak
+		return true
+	}).DoErr(func(tx *Transaction) error {
+		return errPermanent
+	}).Done()
+	if err := s.Exec(failed); err != errPermanent {
+		t.Fatal(err)
+	}
+	if history := readTVar(s, tvar); history[0] != 0 {
+		t.Fatalf("a rolled back change leaked: %v", history)
+	}
+}
+
+func TestTVarConcurrentIncrements(t *testing.T) {
+	for _, mode := range lockingModes {
+		s := NewSTM()
+		s.SetLockingMode(mode)
+		counter := NewTVar(s, 0)
+		wg := new(sync.WaitGroup)
+		for range 50 {
+			wg.Add(1)
+			s.NewT().Do(func(tx *Transaction) bool {
+				return WriteTVar(tx, counter, ReadTVar(tx, counter)+1)
+			}).Done().Go(wg)
+		}
+		wg.Wait()
+		if count := readTVar(s, counter); count != 50 {
+			t.Fatalf("%v: count = %d", mode, count)
+		}
+	}
+}
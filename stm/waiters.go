@@ -0,0 +1,71 @@
+/**
+* waiters.go
+* @description The wait/notify registry used by transactions blocked in `Retry`.
+ */
+
+package stm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// waitRegistry keeps track of the transactions waiting for `MemoryCell`s to be committed.
+// `waiters`: For each MemoryCell, the set of wakeup channels of the transactions waiting on it
+// `registered`: The number of waiters registered, so that notifying doesn't lock the registry when there are none
+type waitRegistry struct {
+	mutex      sync.Mutex
+	waiters    map[*MemoryCell]map[chan struct{}]bool
+	registered atomic.Int64
+}
+
+// newWaitRegistry makes a new, empty, waitRegistry.
+func newWaitRegistry() *waitRegistry {
+	registry := new(waitRegistry)
+	registry.waiters = make(map[*MemoryCell]map[chan struct{}]bool, 0)
+	return registry
+}
+
+// register registers a waiter on all the memory cells. The returned channel receives a
+// signal when any of the memory cells is committed.
+func (registry *waitRegistry) register(memcells []*MemoryCell) chan struct{} {
+	wakeup := make(chan struct{}, 1) // buffered so that notify never blocks
+	registry.registered.Add(1)
+	registry.mutex.Lock()
+	for _, memcell := range memcells {
+		if registry.waiters[memcell] == nil {
+			registry.waiters[memcell] = make(map[chan struct{}]bool, 0)
+		}
+		registry.waiters[memcell][wakeup] = true
+	}
+	registry.mutex.Unlock()
+	return wakeup
+}
+
+// unregister removes the waiter from all the memory cells it was registered on.
+func (registry *waitRegistry) unregister(memcells []*MemoryCell, wakeup chan struct{}) {
+	registry.mutex.Lock()
+	for _, memcell := range memcells {
+		delete(registry.waiters[memcell], wakeup)
+		if len(registry.waiters[memcell]) == 0 {
+			delete(registry.waiters, memcell)
+		}
+	}
+	registry.mutex.Unlock()
+	registry.registered.Add(-1)
+}
+
+// notify wakes up all the waiters registered on the memory cell.
+func (registry *waitRegistry) notify(memcell *MemoryCell) {
+	if registry.registered.Load() == 0 {
+		return // the waiters check the memory cells after registering, so none can be missed
+	}
+	registry.mutex.Lock()
+	for wakeup := range registry.waiters[memcell] {
+		select {
+		case wakeup <- struct{}{}:
+		default: // already signalled
+		}
+	}
+	registry.mutex.Unlock()
+}